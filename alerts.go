@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	errors "github.com/pkg/errors"
+)
+
+const (
+	// MetricIndex compares the index price of a pair
+	MetricIndex = "index"
+	// MetricPrice compares the price of a pair on each exchange
+	MetricPrice = "price"
+	// MetricSpread compares the percentage spread of a pair between exchanges
+	MetricSpread = "spread"
+	// MetricUnavailable holds while any of an exchange's pairs can't be fetched or has gone stale
+	MetricUnavailable = "unavailable"
+)
+
+const (
+	// AlertPending is the state of an alert whose condition holds but hasn't fired yet, either
+	// because it hasn't held for long enough or because the rule is cooling down
+	AlertPending = "pending"
+	// AlertFiring is the state of an alert that has fired and whose condition still holds
+	AlertFiring = "firing"
+	// AlertResolved is the state of an alert that fired and whose condition has since cleared
+	AlertResolved = "resolved"
+)
+
+var (
+	// alertTick is how often rules are evaluated when no quotes change, so that time based
+	// conditions like staleness are picked up
+	alertTick = 5 * time.Second
+	// alertBuffer is how many quote changes are queued for the alert engine
+	alertBuffer = 256
+)
+
+// AlertsConfig is the alerts section of the config file
+type AlertsConfig struct {
+	// Cooldown is how long after an alert fires before it can fire again
+	Cooldown time.Duration `yaml:"cooldown"`
+	// Rules are the conditions that raise alerts
+	Rules []AlertRule `yaml:"rules"`
+}
+
+// AlertRule is a condition on the quotes that raises an alert while it holds
+type AlertRule struct {
+	Name string `yaml:"name"`
+	// Metric is index, price, spread or unavailable
+	Metric string `yaml:"metric"`
+	// Asset is the asset the rule applies to, every asset if it isn't set
+	Asset string `yaml:"asset"`
+	// Quote is the quote currency the rule applies to, every quote currency if it isn't set
+	Quote string `yaml:"quote"`
+	// Exchanges are the exchanges price and unavailable rules apply to, every exchange if none
+	// are set. Spread rules compare two exchanges if they're set, or the cheapest and most
+	// expensive exchange otherwise
+	Exchanges []string `yaml:"exchanges"`
+	// Op is above or below, and isn't needed for unavailable rules
+	Op    string  `yaml:"op"`
+	Value float64 `yaml:"value"`
+	// For is how long the condition has to hold before the alert fires
+	For time.Duration `yaml:"for"`
+}
+
+// check validates a rule from the config and normalizes its names
+func (r *AlertRule) check() error {
+	if r.Name == "" {
+		return errors.New("alert rules need a name")
+	}
+	r.Asset = strings.ToUpper(r.Asset)
+	r.Quote = strings.ToUpper(r.Quote)
+
+	switch r.Metric {
+	case MetricIndex, MetricPrice, MetricSpread:
+		if r.Op != "above" && r.Op != "below" {
+			return errors.New("alert rule " + r.Name + " needs an op of above or below")
+		}
+	case MetricUnavailable:
+	default:
+		return errors.New("alert rule " + r.Name + " has an unknown metric: " + r.Metric)
+	}
+
+	if r.Metric == MetricSpread && len(r.Exchanges) != 0 && len(r.Exchanges) != 2 {
+		return errors.New("spread rule " + r.Name + " needs two exchanges or none")
+	}
+	for i, name := range r.Exchanges {
+		exchange, ok := lookupExchange(name)
+		if !ok {
+			return errors.New("alert rule " + r.Name + " has an unknown exchange: " + name)
+		}
+		r.Exchanges[i] = exchange.Name()
+	}
+	return nil
+}
+
+// matches checks whether the rule applies to a pair
+func (r AlertRule) matches(pair Pair) bool {
+	return (r.Asset == "" || r.Asset == pair.Base) && (r.Quote == "" || r.Quote == pair.Quote)
+}
+
+// appliesTo checks whether a price or unavailable rule applies to an exchange
+func (r AlertRule) appliesTo(exchange string) bool {
+	return len(r.Exchanges) == 0 || contains(r.Exchanges, exchange)
+}
+
+// compare checks a value against the rule's threshold
+func (r AlertRule) compare(value float64) bool {
+	if r.Op == "below" {
+		return value < r.Value
+	}
+	return value > r.Value
+}
+
+// Alert is the state of a rule for a single pair, and exchange if the rule looks at exchanges
+// separately. Unavailable rules raise an alert per exchange rather than per pair, so their alerts
+// have no asset or quote. It's also what notifiers are sent when an alert fires or resolves
+type Alert struct {
+	Rule     string  `json:"rule"`
+	Asset    string  `json:"asset"`
+	Quote    string  `json:"quote"`
+	Exchange string  `json:"exchange,omitempty"`
+	Value    float64 `json:"value"`
+	State    string  `json:"state"`
+	Message  string  `json:"message"`
+	// Since is when the alert entered its current state
+	Since time.Time `json:"since"`
+	// Time is when the alert was last evaluated
+	Time time.Time `json:"time"`
+}
+
+// key identifies the alert among the alerts raised by every rule
+func (a Alert) key() string {
+	return a.Rule + "|" + a.Asset + "/" + a.Quote + "|" + a.Exchange
+}
+
+// observation is a rule's condition evaluated against a single pair and exchange
+type observation struct {
+	alert Alert
+	holds bool
+}
+
+// observe evaluates a rule against a snapshot. Pairs and exchanges that there's no data for
+// are left out, which resolves any alert they had raised
+func (r AlertRule) observe(snapshot *Snapshot) []observation {
+	if r.Metric == MetricUnavailable {
+		return r.unavailable(snapshot)
+	}
+
+	var list []observation
+	for _, pair := range config.Pairs() {
+		if !r.matches(pair) {
+			continue
+		}
+		alert := Alert{Rule: r.Name, Asset: pair.Base, Quote: pair.Quote}
+
+		switch r.Metric {
+		case MetricIndex:
+			if index, ok := computeIndex(snapshot, pair); ok {
+				alert.Value = index.Price
+				alert.Message = fmt.Sprintf("%s index price is %g, %s %g", pair, index.Price, r.Op, r.Value)
+				list = append(list, observation{alert: alert, holds: r.compare(index.Price)})
+			}
+
+		case MetricSpread:
+			if value, between, ok := r.spread(snapshot, pair); ok {
+				// rules comparing every exchange leave the exchanges out of the alert's key, since the
+				// cheapest and most expensive exchange can change while the alert holds
+				if len(r.Exchanges) != 0 {
+					alert.Exchange = between
+				}
+				alert.Value = value
+				alert.Message = fmt.Sprintf("%s spread between %s is %.2f%%, %s %g%%", pair, between, value, r.Op, r.Value)
+				list = append(list, observation{alert: alert, holds: r.compare(value)})
+			}
+
+		case MetricPrice:
+			for _, exchange := range exchanges {
+				if !r.appliesTo(exchange.Name()) || !listed(exchange, pair.Base) {
+					continue
+				}
+				quote := lookupQuote(snapshot, exchange, pair)
+				if quote.Status != StatusOK {
+					continue
+				}
+				alert.Exchange = exchange.Name()
+				alert.Value = quote.Price
+				alert.Message = fmt.Sprintf("%s on %s is %g, %s %g", pair, exchange.Name(), quote.Price, r.Op, r.Value)
+				list = append(list, observation{alert: alert, holds: r.compare(quote.Price)})
+			}
+		}
+	}
+	return list
+}
+
+// unavailable evaluates an unavailable rule against each exchange. An outage takes every pair on
+// an exchange down at once, so there's a single alert per exchange, holding while any of the pairs
+// the rule matches is down. Its value is the number of pairs that are down
+func (r AlertRule) unavailable(snapshot *Snapshot) []observation {
+	var list []observation
+	for _, exchange := range exchanges {
+		if !r.appliesTo(exchange.Name()) {
+			continue
+		}
+
+		var down []string
+		var reason string
+		fetched := 0
+		for _, pair := range config.Pairs() {
+			if !r.matches(pair) || !listed(exchange, pair.Base) {
+				continue
+			}
+			quote := lookupQuote(snapshot, exchange, pair)
+			if quote.Time.IsZero() {
+				// nothing has been fetched yet, so it's too early to tell
+				continue
+			}
+			fetched++
+			if quote.Status != StatusError && quote.Status != StatusStale {
+				continue
+			}
+			down = append(down, pair.String())
+			if reason == "" {
+				reason = string(quote.Status)
+				if quote.Error != "" {
+					reason += ": " + quote.Error
+				}
+			}
+		}
+		if fetched == 0 {
+			continue
+		}
+
+		alert := Alert{Rule: r.Name, Exchange: exchange.Name(), Value: float64(len(down))}
+		alert.Message = exchange.Name() + " is available"
+		if len(down) != 0 {
+			alert.Message = fmt.Sprintf("%s is unavailable for %d of %d pairs (%s), %s", exchange.Name(), len(down), fetched,
+				strings.Join(down, ", "), reason)
+		}
+		list = append(list, observation{alert: alert, holds: len(down) != 0})
+	}
+	return list
+}
+
+// spread returns the percentage spread a rule looks at for a pair, along with the exchanges it's between
+func (r AlertRule) spread(snapshot *Snapshot, pair Pair) (float64, string, bool) {
+	if len(r.Exchanges) == 0 {
+		spread, ok := computeSpread(snapshot, pair)
+		return spread.Percent, spread.Low + "/" + spread.High, ok
+	}
+
+	var found []float64
+	for _, name := range r.Exchanges {
+		for _, quote := range freshQuotes(snapshot, pair) {
+			if quote.Exchange == name {
+				found = append(found, quote.Price)
+			}
+		}
+	}
+	between := r.Exchanges[0] + "/" + r.Exchanges[1]
+	if len(found) != 2 || math.Min(found[0], found[1]) <= 0 {
+		return 0, between, false
+	}
+	return 100 * math.Abs(found[0]-found[1]) / math.Min(found[0], found[1]), between, true
+}
+
+// Notifier delivers alerts when they fire or resolve
+type Notifier interface {
+	Name() string
+	// Notify sends an alert, giving up if ctx is done
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// AlertEngine evaluates the alert rules against the quotes and keeps track of the state of every
+// alert. Alerts are sent to the notifiers once when they fire and once when they resolve, and an
+// alert that has fired won't fire again until the cooldown has passed
+type AlertEngine struct {
+	sync.Mutex
+	rules     []AlertRule
+	cooldown  time.Duration
+	notifiers []Notifier
+	alerts    map[string]*Alert
+	// fired is when each alert last fired, which is kept after it resolves for the cooldown
+	fired map[string]time.Time
+	// queue holds alerts waiting to be sent to the notifiers
+	queue chan Alert
+}
+
+// alerts is the running alert engine. It's nil if no rules are configured
+var alerts *AlertEngine
+
+// NewAlertEngine returns an engine evaluating rules that sends alerts to notifiers
+func NewAlertEngine(rules []AlertRule, cooldown time.Duration, notifiers []Notifier) *AlertEngine {
+	return &AlertEngine{
+		rules:     rules,
+		cooldown:  cooldown,
+		notifiers: notifiers,
+		alerts:    make(map[string]*Alert),
+		fired:     make(map[string]time.Time),
+		queue:     make(chan Alert, alertBuffer),
+	}
+}
+
+// Evaluate checks every rule against a snapshot, updating the state of each alert and queueing
+// the alerts that fired or resolved to be sent to the notifiers
+func (e *AlertEngine) Evaluate(snapshot *Snapshot, now time.Time) {
+	e.Lock()
+	defer e.Unlock()
+
+	seen := make(map[string]bool)
+	latest := make(map[string]Alert)
+	for _, rule := range e.rules {
+		for _, obs := range rule.observe(snapshot) {
+			key := obs.alert.key()
+			latest[key] = obs.alert
+			if !obs.holds {
+				continue
+			}
+			seen[key] = true
+
+			alert, ok := e.alerts[key]
+			if !ok || alert.State == AlertResolved {
+				alert = &obs.alert
+				alert.State = AlertPending
+				alert.Since = now
+				e.alerts[key] = alert
+			}
+			alert.Value = obs.alert.Value
+			alert.Message = obs.alert.Message
+			alert.Time = now
+
+			if alert.State == AlertPending && now.Sub(alert.Since) >= rule.For && now.Sub(e.fired[key]) >= e.cooldown {
+				alert.State = AlertFiring
+				alert.Since = now
+				e.fired[key] = now
+				e.send(*alert)
+			}
+		}
+	}
+
+	for key, alert := range e.alerts {
+		if seen[key] || alert.State == AlertResolved {
+			continue
+		}
+		if alert.State == AlertPending {
+			// the condition cleared before the alert fired, so there's nothing to resolve
+			delete(e.alerts, key)
+			continue
+		}
+		if current, ok := latest[key]; ok {
+			alert.Value = current.Value
+			alert.Message = current.Message
+		}
+		alert.State = AlertResolved
+		alert.Since = now
+		alert.Time = now
+		e.send(*alert)
+	}
+}
+
+// send queues an alert for the notifiers, dropping it if the queue is full so that a slow
+// notifier can't hold up evaluation. It must be called with the lock held
+func (e *AlertEngine) send(alert Alert) {
+	log.Println("alert", alert.State+":", alert.Rule, "-", alert.Message)
+	select {
+	case e.queue <- alert:
+	default:
+		log.Println("alert queue full, dropping", alert.Rule, alert.State)
+	}
+}
+
+// Alerts returns the current state of every alert, ordered by rule
+func (e *AlertEngine) Alerts() []Alert {
+	e.Lock()
+	defer e.Unlock()
+	list := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		list = append(list, *alert)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].key() < list[j].key() })
+	return list
+}
+
+// deliver passes queued alerts on to every notifier until ctx is done, returning once the
+// notifiers have stopped. Each notifier has its own queue and goroutine, so one that's slow or
+// retrying doesn't hold up the others
+func (e *AlertEngine) deliver(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	queues := make([]chan Alert, len(e.notifiers))
+	for i, notifier := range e.notifiers {
+		queues[i] = make(chan Alert, alertBuffer)
+		wg.Add(1)
+		go func(notifier Notifier, queue chan Alert) {
+			defer wg.Done()
+			notify(ctx, notifier, queue)
+		}(notifier, queues[i])
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-e.queue:
+			for i, queue := range queues {
+				select {
+				case queue <- alert:
+				default:
+					log.Println("queue for", e.notifiers[i].Name(), "full, dropping", alert.Rule, alert.State)
+				}
+			}
+		}
+	}
+}
+
+// notify sends the alerts in queue to a notifier in order until ctx is done
+func notify(ctx context.Context, notifier Notifier, queue chan Alert) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-queue:
+			err := notifier.Notify(ctx, alert)
+			if err != nil {
+				log.Println("could not send alert to", notifier.Name(), err)
+			}
+		}
+	}
+}
+
+// startAlerts evaluates the alert rules whenever a quote changes and every alertTick until ctx is done
+func startAlerts(ctx context.Context, engine *AlertEngine) {
+	log.Println("evaluating", len(engine.rules), "alert rules")
+	go engine.deliver(ctx)
+	go func() {
+		updates := store.Subscribe(alertBuffer)
+		defer store.Unsubscribe(updates)
+		ticker := time.NewTicker(alertTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-updates:
+			case <-ticker.C:
+			}
+			engine.Evaluate(store.Snapshot(), time.Now())
+		}
+	}()
+}
+
+// AlertsResponse is the response to /api/v1/alerts
+type AlertsResponse struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+// getAlerts serves /api/v1/alerts, listing pending, firing and resolved alerts
+func getAlerts() {
+	http.HandleFunc("/api/v1/alerts", func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+
+		response := AlertsResponse{Alerts: []Alert{}}
+		if alerts != nil {
+			response.Alerts = alerts.Alerts()
+		}
+		writeJSON(w, response)
+	})
+}
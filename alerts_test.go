@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// alertConfig quotes BTC, ETH and ADA against USD on Binance and Kraken
+var alertConfig = `
+assets: [BTC, ETH, ADA]
+quotes: [USD]
+exchanges: [binance, kraken]
+`
+
+// testRule checks a rule the way loading the config would
+func testRule(t *testing.T, rule AlertRule) AlertRule {
+	t.Helper()
+	err := rule.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+// sentAlerts returns the alerts the engine has queued for the notifiers since it was last called
+func sentAlerts(engine *AlertEngine) []Alert {
+	var list []Alert
+	for {
+		select {
+		case alert := <-engine.queue:
+			list = append(list, alert)
+		default:
+			return list
+		}
+	}
+}
+
+// alertStep is the quotes an engine is evaluated against at a point in time, along with the
+// state of the alert it should be left with and the state it should have sent, if any
+type alertStep struct {
+	at     time.Duration
+	quotes map[string]Quote
+	state  string
+	sent   string
+}
+
+// runAlertSteps evaluates a single rule through steps, checking the rule's only alert after each
+func runAlertSteps(t *testing.T, name string, rule AlertRule, cooldown time.Duration, steps []alertStep) []Alert {
+	t.Helper()
+	engine := NewAlertEngine([]AlertRule{testRule(t, rule)}, cooldown, nil)
+	start := time.Now()
+	var last []Alert
+	for _, step := range steps {
+		engine.Evaluate(btcQuotes(step.quotes), start.Add(step.at))
+		last = engine.Alerts()
+
+		state := ""
+		if len(last) > 1 {
+			t.Fatalf("%s at %v: got alerts %+v, want one", name, step.at, last)
+		}
+		if len(last) == 1 {
+			state = last[0].State
+		}
+		if state != step.state {
+			t.Errorf("%s at %v: got state %q, want %q", name, step.at, state, step.state)
+		}
+
+		sent := sentAlerts(engine)
+		switch {
+		case step.sent == "" && len(sent) != 0:
+			t.Errorf("%s at %v: sent %+v", name, step.at, sent)
+		case step.sent != "" && (len(sent) != 1 || sent[0].State != step.sent):
+			t.Errorf("%s at %v: sent %+v, want a %s alert", name, step.at, sent, step.sent)
+		}
+	}
+	return last
+}
+
+func TestAlertTransitions(t *testing.T) {
+	testConfig(t, alertConfig)
+	above := map[string]Quote{"Binance": NewQuote(101, 1), "Kraken": NewQuote(101, 1)}
+	below := map[string]Quote{"Binance": NewQuote(99, 1), "Kraken": NewQuote(99, 1)}
+	index := AlertRule{Name: "btc above 100", Metric: MetricIndex, Asset: "btc", Op: "above", Value: 100, For: time.Minute}
+
+	for _, test := range []struct {
+		name     string
+		cooldown time.Duration
+		steps    []alertStep
+	}{
+		{"fires after holding for a minute and resolves", 0, []alertStep{
+			{0, above, AlertPending, ""},
+			{30 * time.Second, above, AlertPending, ""},
+			{time.Minute, above, AlertFiring, AlertFiring},
+			{2 * time.Minute, above, AlertFiring, ""},
+			{3 * time.Minute, below, AlertResolved, AlertResolved},
+			{4 * time.Minute, below, AlertResolved, ""},
+		}},
+		{"clears before firing", 0, []alertStep{
+			{0, above, AlertPending, ""},
+			{30 * time.Second, below, "", ""},
+			// the condition starts holding again, so the minute starts over
+			{40 * time.Second, above, AlertPending, ""},
+			{time.Minute, above, AlertPending, ""},
+			{100 * time.Second, above, AlertFiring, AlertFiring},
+		}},
+		{"waits out the cooldown before firing again", 10 * time.Minute, []alertStep{
+			{0, above, AlertPending, ""},
+			{time.Minute, above, AlertFiring, AlertFiring},
+			{2 * time.Minute, below, AlertResolved, AlertResolved},
+			{3 * time.Minute, above, AlertPending, ""},
+			{5 * time.Minute, above, AlertPending, ""},
+			{11 * time.Minute, above, AlertFiring, AlertFiring},
+		}},
+	} {
+		runAlertSteps(t, test.name, index, test.cooldown, test.steps)
+	}
+}
+
+func TestAlertRules(t *testing.T) {
+	testConfig(t, alertConfig)
+	wide := map[string]Quote{"Binance": NewQuote(102, 1), "Kraken": NewQuote(100, 1)}
+	narrow := map[string]Quote{"Binance": NewQuote(100.5, 1), "Kraken": NewQuote(100, 1)}
+
+	for _, test := range []struct {
+		name     string
+		rule     AlertRule
+		steps    []alertStep
+		exchange string
+	}{
+		{
+			"spread between two exchanges",
+			AlertRule{Name: "spread", Metric: MetricSpread, Asset: "BTC", Exchanges: []string{"kraken", "binance"}, Op: "above", Value: 1},
+			[]alertStep{{0, wide, AlertFiring, AlertFiring}, {time.Minute, narrow, AlertResolved, AlertResolved}},
+			"Kraken/Binance",
+		},
+		{
+			"spread across every exchange",
+			AlertRule{Name: "spread", Metric: MetricSpread, Asset: "BTC", Op: "above", Value: 1},
+			[]alertStep{{0, wide, AlertFiring, AlertFiring}, {time.Minute, narrow, AlertResolved, AlertResolved}},
+			"",
+		},
+		{
+			"spread below",
+			AlertRule{Name: "spread", Metric: MetricSpread, Asset: "BTC", Op: "below", Value: 1},
+			[]alertStep{{0, wide, "", ""}, {time.Minute, narrow, AlertFiring, AlertFiring}},
+			"",
+		},
+		{
+			"price on one exchange",
+			AlertRule{Name: "price", Metric: MetricPrice, Asset: "BTC", Exchanges: []string{"binance"}, Op: "above", Value: 101},
+			[]alertStep{{0, narrow, "", ""}, {time.Minute, wide, AlertFiring, AlertFiring}},
+			"Binance",
+		},
+	} {
+		alerts := runAlertSteps(t, test.name, test.rule, 0, test.steps)
+		if len(alerts) == 1 && alerts[0].Exchange != test.exchange {
+			t.Errorf("%s: got alert for %q, want %q", test.name, alerts[0].Exchange, test.exchange)
+		}
+	}
+}
+
+func TestUnavailableAlertPerExchange(t *testing.T) {
+	testConfig(t, alertConfig)
+	rule := AlertRule{Name: "unavailable", Metric: MetricUnavailable, For: time.Minute}
+	engine := NewAlertEngine([]AlertRule{testRule(t, rule)}, 0, nil)
+
+	down := NewSnapshot(time.Now())
+	for _, pair := range config.Pairs() {
+		down.set("Binance", pair, NewQuote(100, 1))
+		down.set("Kraken", pair, ErrorQuote(errors.New("got status 502")))
+	}
+	start := time.Now()
+	engine.Evaluate(down, start)
+	engine.Evaluate(down, start.Add(time.Minute))
+
+	// every pair on kraken is down, which is a single outage
+	alerts := engine.Alerts()
+	if len(alerts) != 1 {
+		t.Fatalf("got alerts %+v, want one for Kraken", alerts)
+	}
+	alert := alerts[0]
+	if alert.State != AlertFiring || alert.Exchange != "Kraken" || alert.Asset != "" || alert.Value != 3 {
+		t.Errorf("got alert %+v", alert)
+	}
+	if !strings.Contains(alert.Message, "3 of 3 pairs") || !strings.Contains(alert.Message, "got status 502") {
+		t.Errorf("got message %q", alert.Message)
+	}
+	if sent := sentAlerts(engine); len(sent) != 1 {
+		t.Errorf("sent %+v, want a single alert", sent)
+	}
+
+	up := NewSnapshot(time.Now())
+	for _, pair := range config.Pairs() {
+		up.set("Kraken", pair, NewQuote(100, 1))
+	}
+	engine.Evaluate(up, start.Add(2*time.Minute))
+	if alerts := engine.Alerts(); len(alerts) != 1 || alerts[0].State != AlertResolved || alerts[0].Message != "Kraken is available" {
+		t.Errorf("got alerts %+v after Kraken recovered", alerts)
+	}
+}
@@ -1,65 +1,37 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"math"
+	"net/url"
 	"strings"
 
 	errors "github.com/pkg/errors"
 
-	erpc "github.com/Varunram/essentials/rpc"
 	utils "github.com/Varunram/essentials/utils"
 )
 
-// BinanceReqBTC is the binance ticker from the API
-var BinanceReqBTC = "https://api.binance.com/api/v1/ticker/price?symbol=BTCUSDT"
-var BinanceReqETH = "https://api.binance.com/api/v1/ticker/price?symbol=ETHUSDT"
-var BinanceReqXRP = "https://api.binance.com/api/v1/ticker/price?symbol=XRPUSDT"
-var BinanceReqLTC = "https://api.binance.com/api/v1/ticker/price?symbol=LTCUSDT"
-var BinanceReqLINK = "https://api.binance.com/api/v1/ticker/price?symbol=LINKUSDT"
-var BinanceReqADA = "https://api.binance.com/api/v1/ticker/price?symbol=ADAUSDT"
-
-var BinanceVolBTC = "https://api.binance.com/api/v1/ticker/24hr?symbol=BTCUSDT"
-var BinanceVolETH = "https://api.binance.com/api/v1/ticker/24hr?symbol=ETHUSDT"
-var BinanceVolXRP = "https://api.binance.com/api/v1/ticker/24hr?symbol=XRPUSDT"
-var BinanceVolLTC = "https://api.binance.com/api/v1/ticker/24hr?symbol=LTCUSDT"
-var BinanceVolLINK = "https://api.binance.com/api/v1/ticker/24hr?symbol=LINKUSDT"
-var BinanceVolADA = "https://api.binance.com/api/v1/ticker/24hr?symbol=ADAUSDT"
-
-var CoinbaseReqBTC = "https://api.pro.coinbase.com/products/BTC-USD/ticker"
-var CoinbaseReqETH = "https://api.pro.coinbase.com/products/ETH-USD/ticker"
-var CoinbaseReqXRP = "https://api.pro.coinbase.com/products/XRP-USD/ticker"
-var CoinbaseReqLTC = "https://api.pro.coinbase.com/products/LTC-USD/ticker"
-var CoinbaseReqLINK = "https://api.pro.coinbase.com/products/LINK-USD/ticker"
-
-// var CoinbaseReqADA = "https://api.pro.coinbase.com/products/ADA-USD/ticker"
-
-var KrakenReqBTC = "https://api.kraken.com/0/public/Ticker?pair=BTCUSD"
-var KrakenReqETH = "https://api.kraken.com/0/public/Ticker?pair=ETHUSD"
-var KrakenReqXRP = "https://api.kraken.com/0/public/Ticker?pair=XRPUSD"
-var KrakenReqLTC = "https://api.kraken.com/0/public/Ticker?pair=LTCUSD"
-var KrakenReqLINK = "https://api.kraken.com/0/public/Ticker?pair=LINKUSD"
-var KrakenReqADA = "https://api.kraken.com/0/public/Ticker?pair=ADAUSD"
-
-var BitfinexReqBTC = "https://api-pub.bitfinex.com/v2/tickers?symbols=tBTCUSD"
-var BitfinexReqETH = "https://api-pub.bitfinex.com/v2/tickers?symbols=tETHUSD"
-var BitfinexReqXRP = "https://api-pub.bitfinex.com/v2/tickers?symbols=tXRPUSD"
-var BitfinexReqLTC = "https://api-pub.bitfinex.com/v2/tickers?symbols=tLTCUSD"
-var BitfinexReqLINK = "https://api-pub.bitfinex.com/v2/tickers?symbols=tLINK:USD"
-var BitfinexReqADA = "https://api-pub.bitfinex.com/v2/tickers?symbols=tADAUSD"
-
-// BinanceTickerResponse defines the ticker API response from Binanace
-type BinanceTickerResponse struct {
-	Symbol string `json:"symbol"`
-	Price  string `json:"price"`
-}
+// BinanceReq is binance's 24hr stats endpoint, formatted with a url encoded JSON array of symbols
+var BinanceReq = "https://api.binance.com/api/v3/ticker/24hr?symbols=%s"
+
+// CoinbaseReq is coinbase's ticker endpoint, formatted with the pair's product id
+var CoinbaseReq = "https://api.pro.coinbase.com/products/%s/ticker"
 
-// BinanceVolumeResponse defines the structure of binance's volume endpoint response
-type BinanceVolumeResponse struct {
+// KrakenReq is kraken's ticker endpoint, formatted with a comma separated list of pair names
+var KrakenReq = "https://api.kraken.com/0/public/Ticker?pair=%s"
+
+// BitfinexReq is bitfinex's tickers endpoint, formatted with a comma separated list of symbols
+var BitfinexReq = "https://api-pub.bitfinex.com/v2/tickers?symbols=%s"
+
+// BinanceTickerResponse defines the structure of each symbol in binance's 24hr stats response
+type BinanceTickerResponse struct {
 	// there are other fields as well, but we ignore them for now
-	Symbol string `json:"symbol"`
-	Volume string `json:"volume"`
+	Symbol    string `json:"symbol"`
+	LastPrice string `json:"lastPrice"`
+	Volume    string `json:"volume"`
 }
 
 // CoinbaseTickerResponse defines the structure of coinbase's ticker endpoitt response
@@ -72,132 +44,139 @@ type CoinbaseTickerResponse struct {
 // KrakenTickerResponse defines the structure of kraken's ticker response
 type KrakenTickerResponse struct {
 	Error  []string `json:"error"`
-	Result struct {
-		XXBTZUSD struct {
-			// there's some additional info here but we don't require that
-			C []string // c = last trade closed array(<price>, <lot volume>),
-			V []string // volume array(<today>, <last 24 hours>)
-		}
-		XETHZUSD struct {
-			// there's some additional info here but we don't require that
-			C []string // c = last trade closed array(<price>, <lot volume>),
-			V []string // volume array(<today>, <last 24 hours>)
-		}
-		XXRPZUSD struct {
-			// there's some additional info here but we don't require that
-			C []string // c = last trade closed array(<price>, <lot volume>),
-			V []string // volume array(<today>, <last 24 hours>)
-		}
-		XLTCZUSD struct {
-			// there's some additional info here but we don't require that
-			C []string // c = last trade closed array(<price>, <lot volume>),
-			V []string // volume array(<today>, <last 24 hours>)
-		}
-		LINKUSD struct {
-			// there's some additional info here but we don't require that
-			C []string // c = last trade closed array(<price>, <lot volume>),
-			V []string // volume array(<today>, <last 24 hours>)
-		}
-		ADAUSD struct {
-			// there's some additional info here but we don't require that
-			C []string // c = last trade closed array(<price>, <lot volume>),
-			V []string // volume array(<today>, <last 24 hours>)
-		}
+	Result map[string]struct {
+		// there's some additional info here but we don't require that
+		C []string // c = last trade closed array(<price>, <lot volume>),
+		V []string // volume array(<today>, <last 24 hours>)
 	}
 }
 
-type BitfinexTickerResponse struct {
-	Price  string
-	Volume string
+// BinanceSymbols translates pairs to Binance's symbols. Binance doesn't have USD pairs, so we use USDT instead
+var BinanceSymbols = SymbolTable{
+	Assets: map[string]string{"USD": "USDT"},
+	Format: func(base string, quote string) string { return base + quote },
 }
 
-// BinanceTicker gets price data from Binance
-func BinanceTicker(coin string) (float64, error) {
-	var data []byte
-	var err error
-	if coin == "BTC" {
-		data, err = erpc.GetRequest(BinanceReqBTC)
-	} else if coin == "ETH" {
-		data, err = erpc.GetRequest(BinanceReqETH)
-	} else if coin == "XRP" {
-		data, err = erpc.GetRequest(BinanceReqXRP)
-	} else if coin == "LTC" {
-		data, err = erpc.GetRequest(BinanceReqLTC)
-	} else if coin == "LINK" {
-		data, err = erpc.GetRequest(BinanceReqLINK)
-	} else if coin == "ADA" {
-		data, err = erpc.GetRequest(BinanceReqADA)
-	}
-	if err != nil {
-		log.Println("did not get response", err)
-		return -1, errors.Wrap(err, "did not get response from Binance API")
-	}
+// CoinbaseSymbols translates pairs to Coinbase's product ids
+var CoinbaseSymbols = SymbolTable{
+	Format: func(base string, quote string) string { return base + "-" + quote },
+}
 
-	var response BinanceTickerResponse
-	err = json.Unmarshal(data, &response)
-	if err != nil {
-		return -1, errors.Wrap(err, "could not unmarshal response")
-	}
+// KrakenSymbols translates pairs to Kraken's pair names. Kraken's responses use the legacy X/Z
+// prefixed names for older assets, eg XXBTZUSD for BTC/USD
+var KrakenSymbols = SymbolTable{
+	Assets: map[string]string{"BTC": "XBT", "DOGE": "XDG"},
+	Aliases: map[string]string{
+		"XXBT": "BTC",
+		"XETH": "ETH",
+		"XXRP": "XRP",
+		"XLTC": "LTC",
+		"XXDG": "DOGE",
+		"ZUSD": "USD",
+		"ZEUR": "EUR",
+		"ZGBP": "GBP",
+	},
+	Format: func(base string, quote string) string { return base + quote },
+}
 
-	// response.Price is in string, need to convert it to float
-	price, err := utils.ToFloat(response.Price)
-	if err != nil {
-		return -1, errors.Wrap(err, "could not convert price from string to float, quitting!")
-	}
+// BitfinexSymbols translates pairs to Bitfinex's trading symbols. Assets with names longer than
+// three characters are separated from the quote currency with a colon
+var BitfinexSymbols = SymbolTable{
+	Prefix: "t",
+	Assets: map[string]string{"USDT": "UST", "DASH": "DSH", "IOTA": "IOT"},
+	Format: func(base string, quote string) string {
+		if len(base) > 3 || len(quote) > 3 {
+			return base + ":" + quote
+		}
+		return base + quote
+	},
+}
+
+func init() {
+	RegisterExchange("binance", Binance{})
+	RegisterExchange("coinbase", Coinbase{})
+	RegisterExchange("kraken", Kraken{})
+	RegisterExchange("bitfinex", Bitfinex{})
+}
+
+// Binance fetches ticker data from Binance
+type Binance struct{}
+
+// Name returns the name of the exchange
+func (Binance) Name() string {
+	return "Binance"
+}
 
-	return math.Round(price*1000) / 1000, nil
+// Symbols returns the coins listed on Binance
+func (Binance) Symbols() []string {
+	return []string{"BTC", "ETH", "XRP", "LTC", "LINK", "ADA"}
 }
 
-// BinanceVolume gets volume data from Binance
-func BinanceVolume(coin string) (float64, error) {
-	var data []byte
-	var err error
-	if coin == "BTC" {
-		data, err = erpc.GetRequest(BinanceVolBTC)
-	} else if coin == "ETH" {
-		data, err = erpc.GetRequest(BinanceVolETH)
-	} else if coin == "XRP" {
-		data, err = erpc.GetRequest(BinanceVolXRP)
-	} else if coin == "LTC" {
-		data, err = erpc.GetRequest(BinanceVolLTC)
-	} else if coin == "LINK" {
-		data, err = erpc.GetRequest(BinanceVolLINK)
-	} else if coin == "ADA" {
-		data, err = erpc.GetRequest(BinanceVolADA)
+// Ticker gets price and volume data from Binance
+func (b Binance) Ticker(ctx context.Context, pair Pair) (float64, float64, error) {
+	return single(ctx, b, pair)
+}
+
+// Tickers gets the price and volume of every pair from Binance's 24hr stats in a single request
+func (Binance) Tickers(ctx context.Context, pairs []Pair) (map[Pair]Quote, error) {
+	symbols := make([]string, len(pairs))
+	for i, pair := range pairs {
+		symbols[i] = BinanceSymbols.Symbol(pair)
 	}
+	list, err := json.Marshal(symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := getRequest(ctx, "Binance", fmt.Sprintf(BinanceReq, url.QueryEscape(string(list))))
 	if err != nil {
 		log.Println("did not get response", err)
-		return -1, errors.Wrap(err, "did not get response from Binance API")
+		return nil, errors.Wrap(err, "did not get response from Binance API")
 	}
 
-	var response BinanceVolumeResponse
+	var response []BinanceTickerResponse
 	err = json.Unmarshal(data, &response)
 	if err != nil {
-		return -1, errors.Wrap(err, "could not unmarshal response")
+		return nil, errors.Wrap(err, "could not unmarshal response")
 	}
-	volume, err := utils.ToFloat(response.Volume)
-	if err != nil {
-		return -1, errors.Wrap(err, "could not convert price from string to float, quitting!")
+
+	quotes := make(map[Pair]Quote)
+	for _, ticker := range response {
+		pair, ok := BinanceSymbols.Parse(ticker.Symbol, pairs)
+		if !ok {
+			continue
+		}
+		// response.Price is in string, need to convert it to float
+		price, err := utils.ToFloat(ticker.LastPrice)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not convert price from string to float, quitting!")
+		}
+		volume, err := utils.ToFloat(ticker.Volume)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not convert volume from string to float, quitting!")
+		}
+		// volume is in the base asset and not usd
+		quotes[pair] = NewQuote(math.Round(price*1000)/1000, math.Round(volume*1000)/1000)
 	}
+	return quotes, nil
+}
+
+// Coinbase fetches ticker data from Coinbase
+type Coinbase struct{}
 
-	return math.Round(volume*1000) / 1000, nil // volume is in BTC and not usd
+// Name returns the name of the exchange
+func (Coinbase) Name() string {
+	return "Coinbase"
 }
 
-// CoinbaseTicker gets ticker data from coinbase
-func CoinbaseTicker(coin string) (float64, float64, error) {
-	var data []byte
-	var err error
-	if coin == "BTC" {
-		data, err = erpc.GetRequest(CoinbaseReqBTC)
-	} else if coin == "ETH" {
-		data, err = erpc.GetRequest(CoinbaseReqETH)
-	} else if coin == "XRP" {
-		data, err = erpc.GetRequest(CoinbaseReqXRP)
-	} else if coin == "LTC" {
-		data, err = erpc.GetRequest(CoinbaseReqLTC)
-	} else if coin == "LINK" {
-		data, err = erpc.GetRequest(CoinbaseReqLINK)
-	}
+// Symbols returns the coins listed on Coinbase
+func (Coinbase) Symbols() []string {
+	return []string{"BTC", "ETH", "XRP", "LTC", "LINK"}
+}
+
+// Ticker gets ticker data from coinbase
+func (Coinbase) Ticker(ctx context.Context, pair Pair) (float64, float64, error) {
+	data, err := getRequest(ctx, "Coinbase", fmt.Sprintf(CoinbaseReq, CoinbaseSymbols.Symbol(pair)))
 	if err != nil {
 		log.Println("did not get response", err)
 		return -1, -1, errors.Wrap(err, "did not get response from Coinbase API")
@@ -224,106 +203,127 @@ func CoinbaseTicker(coin string) (float64, float64, error) {
 	return math.Round(price*1000) / 1000, math.Round(volume*1000) / 1000, nil
 }
 
-// KrakenTicker gets ticker data from kraken
-func KrakenTicker(coin string) (float64, float64, error) {
-	var data []byte
-	var err error
-	if coin == "BTC" {
-		data, err = erpc.GetRequest(KrakenReqBTC)
-	} else if coin == "ETH" {
-		data, err = erpc.GetRequest(KrakenReqETH)
-	} else if coin == "XRP" {
-		data, err = erpc.GetRequest(KrakenReqXRP)
-	} else if coin == "LTC" {
-		data, err = erpc.GetRequest(KrakenReqLTC)
-	} else if coin == "LINK" {
-		data, err = erpc.GetRequest(KrakenReqLINK)
-	} else if coin == "ADA" {
-		data, err = erpc.GetRequest(KrakenReqADA)
+// Kraken fetches ticker data from Kraken
+type Kraken struct{}
+
+// Name returns the name of the exchange
+func (Kraken) Name() string {
+	return "Kraken"
+}
+
+// Symbols returns the coins listed on Kraken
+func (Kraken) Symbols() []string {
+	return []string{"BTC", "ETH", "XRP", "LTC", "LINK", "ADA"}
+}
+
+// Ticker gets ticker data from kraken
+func (k Kraken) Ticker(ctx context.Context, pair Pair) (float64, float64, error) {
+	return single(ctx, k, pair)
+}
+
+// Tickers gets ticker data for every pair from kraken in a single request
+func (Kraken) Tickers(ctx context.Context, pairs []Pair) (map[Pair]Quote, error) {
+	names := make([]string, len(pairs))
+	for i, pair := range pairs {
+		names[i] = KrakenSymbols.Symbol(pair)
 	}
+
+	data, err := getRequest(ctx, "Kraken", fmt.Sprintf(KrakenReq, strings.Join(names, ",")))
 	if err != nil {
 		log.Println("did not get response", err)
-		return -1, -1, errors.Wrap(err, "did not get response from Kraken API")
+		return nil, errors.Wrap(err, "did not get response from Kraken API")
 	}
 
 	var response KrakenTickerResponse
 	err = json.Unmarshal(data, &response)
 	if err != nil {
-		return -1, -1, errors.Wrap(err, "could not unmarshal response")
+		return nil, errors.Wrap(err, "could not unmarshal response")
 	}
 
-	// response.Price is in string, need to convert it to float
-	var price float64
-	var volume float64
-
-	var err1 error
-	var err2 error
-
-	if coin == "BTC" {
-		price, err1 = utils.ToFloat(response.Result.XXBTZUSD.C[0])
-		volume, err2 = utils.ToFloat(response.Result.XXBTZUSD.V[1])
-	} else if coin == "ETH" {
-		price, err1 = utils.ToFloat(response.Result.XETHZUSD.C[0])
-		volume, err2 = utils.ToFloat(response.Result.XETHZUSD.V[1])
-	} else if coin == "XRP" {
-		price, err1 = utils.ToFloat(response.Result.XXRPZUSD.C[0])
-		volume, err2 = utils.ToFloat(response.Result.XXRPZUSD.V[1])
-	} else if coin == "LTC" {
-		price, err1 = utils.ToFloat(response.Result.XLTCZUSD.C[0])
-		volume, err2 = utils.ToFloat(response.Result.XLTCZUSD.V[1])
-	} else if coin == "LINK" {
-		price, err1 = utils.ToFloat(response.Result.LINKUSD.C[0])
-		volume, err2 = utils.ToFloat(response.Result.LINKUSD.V[1])
-	} else if coin == "ADA" {
-		price, err1 = utils.ToFloat(response.Result.ADAUSD.C[0])
-		volume, err2 = utils.ToFloat(response.Result.ADAUSD.V[1])
+	if len(response.Error) != 0 {
+		// query errors are about the pairs asked for, the rest are kraken's own trouble
+		if strings.HasPrefix(response.Error[0], "EQuery:") {
+			return nil, rejectedError(strings.Join(response.Error, ", "))
+		}
+		return nil, errors.New(strings.Join(response.Error, ", "))
 	}
 
-	if err1 != nil || err2 != nil {
-		return -1, -1, errors.Wrap(err, "could not convert price from string to float, quitting!")
+	quotes := make(map[Pair]Quote)
+	for symbol, ticker := range response.Result {
+		pair, ok := KrakenSymbols.Parse(symbol, pairs)
+		if !ok {
+			continue
+		}
+		if len(ticker.C) < 1 || len(ticker.V) < 2 {
+			return nil, errors.New("malformed response from Kraken API")
+		}
+		// response.Price is in string, need to convert it to float
+		price, err := utils.ToFloat(ticker.C[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "could not convert price from string to float, quitting!")
+		}
+		volume, err := utils.ToFloat(ticker.V[1])
+		if err != nil {
+			return nil, errors.Wrap(err, "could not convert volume from string to float, quitting!")
+		}
+		quotes[pair] = NewQuote(math.Round(price*1000)/1000, math.Round(volume*1000)/1000)
 	}
-
-	return math.Round(price*1000) / 1000, math.Round(volume*1000) / 1000, nil
+	return quotes, nil
 }
 
-// BitfinexTicker gets ticker data from kraken
-func BitfinexTicker(coin string) (float64, float64, error) {
-	var data []byte
-	var err error
-	if coin == "BTC" {
-		data, err = erpc.GetRequest(BitfinexReqBTC)
-	} else if coin == "ETH" {
-		data, err = erpc.GetRequest(BitfinexReqETH)
-	} else if coin == "XRP" {
-		data, err = erpc.GetRequest(BitfinexReqXRP)
-	} else if coin == "LTC" {
-		data, err = erpc.GetRequest(BitfinexReqLTC)
-	} else if coin == "LINK" {
-		data, err = erpc.GetRequest(BitfinexReqLINK)
-	} else if coin == "ADA" {
-		data, err = erpc.GetRequest(BitfinexReqADA)
-	}
-	if err != nil {
-		log.Println("did not get response", err)
-		return -1, -1, errors.Wrap(err, "did not get response from BITFINEX API")
-	}
+// Bitfinex fetches ticker data from Bitfinex
+type Bitfinex struct{}
 
-	response := string(data)
-	response = response[1:]
-	response = response[0 : len(response)-1]
+// Name returns the name of the exchange
+func (Bitfinex) Name() string {
+	return "Bitfinex"
+}
 
-	responseArr := strings.Split(response, ",")
+// Symbols returns the coins listed on Bitfinex
+func (Bitfinex) Symbols() []string {
+	return []string{"BTC", "ETH", "XRP", "LTC", "LINK", "ADA"}
+}
 
-	price, err := utils.ToFloat(responseArr[1])
-	if err != nil {
-		return -1, -1, errors.Wrap(err, "did not get response from BITFINEX API")
+// Ticker gets ticker data from bitfinex
+func (b Bitfinex) Ticker(ctx context.Context, pair Pair) (float64, float64, error) {
+	return single(ctx, b, pair)
+}
+
+// Tickers gets ticker data for every pair from bitfinex in a single request. Pairs that aren't
+// listed are left out of the response
+func (Bitfinex) Tickers(ctx context.Context, pairs []Pair) (map[Pair]Quote, error) {
+	symbols := make([]string, len(pairs))
+	for i, pair := range pairs {
+		symbols[i] = BitfinexSymbols.Symbol(pair)
 	}
 
-	volume, err := utils.ToFloat(responseArr[8])
+	rows, err := getRows(ctx, "Bitfinex", fmt.Sprintf(BitfinexReq, strings.Join(symbols, ",")))
 	if err != nil {
-		return -1, -1, errors.Wrap(err, "did not get response from BITFINEX API")
+		log.Println("did not get response", err)
+		return nil, errors.Wrap(err, "could not get tickers from BITFINEX API")
 	}
 
-	// SYMBOL,BID, BID_SIZE, ASK, ASK_SIZE, DAILY_CHANGE, DAILY_CHANGE_RELATIVE, LAST_PRICE, VOLUME, HIGH, LOW
-	return math.Round(price*1000) / 1000, math.Round(volume*1000) / 1000, nil
+	// SYMBOL, BID, BID_SIZE, ASK, ASK_SIZE, DAILY_CHANGE, DAILY_CHANGE_RELATIVE, LAST_PRICE, VOLUME, HIGH, LOW
+	quotes := make(map[Pair]Quote)
+	for _, row := range rows {
+		if len(row) < 9 {
+			return nil, errors.New("malformed response from BITFINEX API")
+		}
+		symbol, _ := row[0].(string)
+		pair, ok := BitfinexSymbols.Parse(symbol, pairs)
+		if !ok {
+			continue
+		}
+
+		price, err := number(row[7])
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read price from BITFINEX API")
+		}
+		volume, err := number(row[8])
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read volume from BITFINEX API")
+		}
+		quotes[pair] = NewQuote(math.Round(price*1000)/1000, math.Round(volume*1000)/1000)
+	}
+	return quotes, nil
 }
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	errors "github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BinanceKlines is binance's kline endpoint, formatted with the symbol, interval and start time in milliseconds
+var BinanceKlines = "https://api.binance.com/api/v3/klines?symbol=%s&interval=%s&startTime=%d&limit=1000"
+
+// CoinbaseCandles is coinbase's candles endpoint, formatted with the product id, granularity in seconds and start and end times
+var CoinbaseCandles = "https://api.pro.coinbase.com/products/%s/candles?granularity=%d&start=%s&end=%s"
+
+// KrakenOHLC is kraken's OHLC endpoint, formatted with the pair, interval in minutes and start time in seconds
+var KrakenOHLC = "https://api.kraken.com/0/public/OHLC?pair=%s&interval=%d&since=%d"
+
+// BitfinexCandles is bitfinex's candles endpoint, formatted with the timeframe, symbol and start time in milliseconds
+var BitfinexCandles = "https://api-pub.bitfinex.com/v2/candles/trade:%s:%s/hist?start=%d&limit=10000&sort=1"
+
+// backfillDelay is how long we wait between requests to an exchange while backfilling
+var backfillDelay = 500 * time.Millisecond
+
+// Backfiller is implemented by exchanges that serve historical candles
+type Backfiller interface {
+	Exchange
+	// Candles returns a page of candles for the pair that open at or after start, oldest first
+	Candles(ctx context.Context, pair Pair, interval string, start time.Time) ([]Candle, error)
+}
+
+// backfillBucket holds how far back each series of candles has been backfilled. It's kept apart
+// from the candles, since the recorder writes candles for the latest intervals as quotes come in
+var backfillBucket = []byte("backfill")
+
+// Backfilled is the span of a series of candles that has been backfilled from an exchange
+type Backfilled struct {
+	From time.Time `json:"from"`
+	// To is the open time of the latest candle fetched
+	To time.Time `json:"to"`
+}
+
+// PutCandles writes backfilled candles for a pair on an exchange, replacing any that open at the
+// same time, and records how far the series has been backfilled
+func (h *History) PutCandles(exchange string, pair Pair, interval string, candles []Candle, done Backfilled) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(candlesBucket)
+		if err != nil {
+			return err
+		}
+		series, err := root.CreateBucketIfNotExists(candleKey(exchange, pair, interval))
+		if err != nil {
+			return err
+		}
+
+		for _, candle := range candles {
+			data, err := json.Marshal(candle)
+			if err != nil {
+				return err
+			}
+			err = series.Put(timeKey(candle.Time), data)
+			if err != nil {
+				return err
+			}
+		}
+
+		progress, err := tx.CreateBucketIfNotExists(backfillBucket)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(done)
+		if err != nil {
+			return err
+		}
+		return progress.Put(candleKey(exchange, pair, interval), data)
+	})
+}
+
+// Backfilled returns how far a series of candles has been backfilled from an exchange
+func (h *History) Backfilled(exchange string, pair Pair, interval string) (Backfilled, bool) {
+	var done Backfilled
+	var ok bool
+	h.db.View(func(tx *bolt.Tx) error {
+		progress := tx.Bucket(backfillBucket)
+		if progress == nil {
+			return nil
+		}
+		data := progress.Get(candleKey(exchange, pair, interval))
+		if data == nil {
+			return nil
+		}
+		ok = json.Unmarshal(data, &done) == nil
+		return nil
+	})
+	return done, ok
+}
+
+// backfill pulls candles for every configured pair and interval from each exchange that serves them,
+// starting since ago. Series that have already been backfilled from at least as far back resume
+// from the latest candle fetched, so it can be rerun to catch up. It stops early if ctx is done,
+// and can be resumed by running it again
+func backfill(ctx context.Context, h *History, since time.Duration) error {
+	start := time.Now().Add(-since)
+	for _, exchange := range exchanges {
+		backfiller, ok := exchange.(Backfiller)
+		if !ok {
+			log.Println(exchange.Name(), "doesn't serve historical candles, skipping")
+			continue
+		}
+
+		for _, pair := range config.Pairs() {
+			if !listed(exchange, pair.Base) {
+				continue
+			}
+			for name, interval := range intervals {
+				from := start.Truncate(interval)
+				done := Backfilled{From: from, To: from}
+				if last, ok := h.Backfilled(exchange.Name(), pair, name); ok && !from.Before(last.From) && last.To.After(from) {
+					// the latest candle might not have closed when it was fetched, so fetch it again
+					done = last
+				}
+
+				err := backfillSeries(ctx, h, backfiller, pair, name, done)
+				if err != nil {
+					return errors.Wrap(err, "could not backfill "+pair.String()+" "+name+" candles from "+exchange.Name())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// backfillSeries pages through the candles for a pair and interval on an exchange from where done
+// leaves off until now
+func backfillSeries(ctx context.Context, h *History, exchange Backfiller, pair Pair, interval string, done Backfilled) error {
+	start := done.To
+	log.Println("backfilling", pair, interval, "candles from", exchange.Name(), "since", start.UTC())
+	count := 0
+	for start.Before(time.Now()) {
+		candles, err := exchange.Candles(ctx, pair, interval, start)
+		if err != nil {
+			return err
+		}
+		if len(candles) == 0 {
+			break
+		}
+
+		done.To = candles[len(candles)-1].Time
+		err = h.PutCandles(exchange.Name(), pair, interval, candles, done)
+		if err != nil {
+			return err
+		}
+		count += len(candles)
+
+		next := done.To.Add(intervals[interval])
+		if !next.After(start) {
+			break
+		}
+		start = next
+		err = sleep(ctx, backfillDelay)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Println("stored", count, pair, interval, "candles from", exchange.Name())
+	return nil
+}
+
+// number converts a number or numeric string from an exchange's response to a float
+func number(x interface{}) (float64, error) {
+	switch v := x.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, errors.New("unexpected value in response")
+}
+
+// parseCandle builds a candle from a row of an exchange's response. unit is the unit of the timestamp in
+// the first field, and the indices give the position of the open, high, low, close and volume fields
+func parseCandle(row []interface{}, unit time.Duration, open, high, low, closing, volume int) (Candle, error) {
+	fields := []int{0, open, high, low, closing, volume}
+	values := make([]float64, len(fields))
+	for i, index := range fields {
+		if index >= len(row) {
+			return Candle{}, errors.New("malformed candle in response")
+		}
+		value, err := number(row[index])
+		if err != nil {
+			return Candle{}, err
+		}
+		values[i] = value
+	}
+
+	return Candle{
+		Time:   time.Unix(0, int64(values[0])*int64(unit)).UTC(),
+		Open:   values[1],
+		High:   values[2],
+		Low:    values[3],
+		Close:  values[4],
+		Volume: values[5],
+	}, nil
+}
+
+// getRows fetches url from an exchange and unmarshals the response as an array of rows
+func getRows(ctx context.Context, exchange string, url string) ([][]interface{}, error) {
+	data, err := getRequest(ctx, exchange, url)
+	if err != nil {
+		return nil, errors.Wrap(err, "did not get response")
+	}
+
+	var rows [][]interface{}
+	err = json.Unmarshal(data, &rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal response")
+	}
+	return rows, nil
+}
+
+// Candles gets a page of klines from Binance
+func (Binance) Candles(ctx context.Context, pair Pair, interval string, start time.Time) ([]Candle, error) {
+	rows, err := getRows(ctx, "Binance", fmt.Sprintf(BinanceKlines, BinanceSymbols.Symbol(pair), interval, start.UnixNano()/1e6))
+	if err != nil {
+		return nil, err
+	}
+
+	// [open time, open, high, low, close, volume, close time, ...]
+	var candles []Candle
+	for _, row := range rows {
+		candle, err := parseCandle(row, time.Millisecond, 1, 2, 3, 4, 5)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// Candles gets a page of candles from Coinbase. Coinbase returns at most 300 candles per request and
+// nothing for windows before the pair was listed, so empty windows are skipped until we find candles
+func (Coinbase) Candles(ctx context.Context, pair Pair, interval string, start time.Time) ([]Candle, error) {
+	granularity := intervals[interval]
+	for start.Before(time.Now()) {
+		end := start.Add(300 * granularity)
+		url := fmt.Sprintf(CoinbaseCandles, CoinbaseSymbols.Symbol(pair), int(granularity.Seconds()),
+			start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+		rows, err := getRows(ctx, "Coinbase", url)
+		if err != nil {
+			return nil, err
+		}
+
+		// [time, low, high, open, close, volume], newest first
+		var candles []Candle
+		for _, row := range rows {
+			candle, err := parseCandle(row, time.Second, 3, 2, 1, 4, 5)
+			if err != nil {
+				return nil, err
+			}
+			candles = append(candles, candle)
+		}
+		if len(candles) != 0 {
+			sort.Slice(candles, func(i, j int) bool { return candles[i].Time.Before(candles[j].Time) })
+			return candles, nil
+		}
+
+		start = end
+		err = sleep(ctx, backfillDelay)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// KrakenOHLCResponse defines the structure of kraken's OHLC response
+type KrakenOHLCResponse struct {
+	Error  []string                   `json:"error"`
+	Result map[string]json.RawMessage `json:"result"`
+}
+
+// Candles gets a page of OHLC data from Kraken. Kraken only serves the latest 720 candles of each interval
+func (Kraken) Candles(ctx context.Context, pair Pair, interval string, start time.Time) ([]Candle, error) {
+	url := fmt.Sprintf(KrakenOHLC, KrakenSymbols.Symbol(pair), int(intervals[interval].Minutes()), start.Unix())
+	data, err := getRequest(ctx, "Kraken", url)
+	if err != nil {
+		return nil, errors.Wrap(err, "did not get response from Kraken API")
+	}
+
+	var response KrakenOHLCResponse
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal response")
+	}
+	if len(response.Error) != 0 {
+		return nil, errors.New(fmt.Sprint(response.Error))
+	}
+
+	var candles []Candle
+	for symbol, raw := range response.Result {
+		if _, ok := KrakenSymbols.Parse(symbol, []Pair{pair}); !ok {
+			// the result also holds the id of the last candle under "last"
+			continue
+		}
+
+		var rows [][]interface{}
+		err = json.Unmarshal(raw, &rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not unmarshal candles")
+		}
+
+		// [time, open, high, low, close, vwap, volume, count]
+		for _, row := range rows {
+			candle, err := parseCandle(row, time.Second, 1, 2, 3, 4, 6)
+			if err != nil {
+				return nil, err
+			}
+			if !candle.Time.Before(start) {
+				candles = append(candles, candle)
+			}
+		}
+	}
+	return candles, nil
+}
+
+// Candles gets a page of candles from Bitfinex
+func (Bitfinex) Candles(ctx context.Context, pair Pair, interval string, start time.Time) ([]Candle, error) {
+	// bitfinex uses 1D rather than 1d for daily candles
+	timeframe := interval
+	if interval == "1d" {
+		timeframe = "1D"
+	}
+
+	rows, err := getRows(ctx, "Bitfinex", fmt.Sprintf(BitfinexCandles, timeframe, BitfinexSymbols.Symbol(pair), start.UnixNano()/1e6))
+	if err != nil {
+		return nil, err
+	}
+
+	// [time, open, close, high, low, volume]
+	var candles []Candle
+	for _, row := range rows {
+		candle, err := parseCandle(row, time.Millisecond, 1, 3, 4, 2, 5)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeBackfiller serves an hourly candle for every hour up to now, a page at a time
+type fakeBackfiller struct {
+	Kraken
+	starts []time.Time
+}
+
+func (f *fakeBackfiller) Name() string {
+	return "Fake"
+}
+
+func (f *fakeBackfiller) Candles(ctx context.Context, pair Pair, interval string, start time.Time) ([]Candle, error) {
+	f.starts = append(f.starts, start)
+	var candles []Candle
+	for t := start.Truncate(time.Hour); !t.After(time.Now()) && len(candles) < 100; t = t.Add(time.Hour) {
+		candles = append(candles, Candle{Time: t, Open: 1, High: 2, Low: 1, Close: 2, Volume: 10})
+	}
+	return candles, nil
+}
+
+func TestBackfillAfterRecording(t *testing.T) {
+	defer func(delay time.Duration, list map[string]time.Duration) { backfillDelay, intervals = delay, list }(backfillDelay, intervals)
+	backfillDelay = 0
+	intervals = map[string]time.Duration{"1h": time.Hour}
+	testConfig(t, "assets: [BTC]\nquotes: [USD]\nexchanges: [kraken]\n")
+	fake := &fakeBackfiller{}
+	exchanges = []Exchange{fake}
+	h := testHistory(t)
+
+	// the dashboard has been running, so the latest interval already has a candle
+	snapshot := NewSnapshot(time.Now())
+	snapshot.set("Fake", btcUSD, NewQuote(100, 1))
+	err := h.Record(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = backfill(context.Background(), h, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candles, err := h.Candles("Fake", btcUSD, "1h", time.Now().Add(-72*time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) < 48 {
+		t.Fatalf("got %d candles after backfilling 48 hours, want the whole range", len(candles))
+	}
+
+	// running it again only fetches from the latest candle
+	fake.starts = nil
+	err = backfill(context.Background(), h, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.starts) != 1 || time.Since(fake.starts[0]) > 2*time.Hour {
+		t.Errorf("rerun fetched pages starting at %v, want a single page from the latest candle", fake.starts)
+	}
+
+	// asking for more history starts over
+	fake.starts = nil
+	err = backfill(context.Background(), h, 96*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.starts) == 0 || time.Since(fake.starts[0]) < 95*time.Hour {
+		t.Errorf("longer backfill started at %v, want 96 hours ago", fake.starts)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// defaultBreakerFailures is how many requests in a row have to fail before a breaker opens
+	// if no limit is set in the config
+	defaultBreakerFailures = 5
+	// defaultBreakerCooldown is how long a breaker stays open if no cooldown is set in the config
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// BreakerConfig is the breaker section of the config file
+type BreakerConfig struct {
+	// Failures is how many requests to an exchange have to fail in a row before its breaker opens. Defaults to 5
+	Failures int `yaml:"failures"`
+	// Cooldown is how long a breaker stays open before a request is let through to check whether the
+	// exchange has recovered. Defaults to 30s
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// BreakerState describes whether requests are being made to an exchange
+type BreakerState string
+
+const (
+	// BreakerClosed is the state of a breaker whose exchange is working, so every request is made
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen is the state of a breaker whose exchange keeps failing, so no requests are made
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen is the state of a breaker that's letting a single request through to probe the exchange
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// breakerStates lists the breaker states in the order they're exported as metrics
+var breakerStates = []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen}
+
+// Breaker is a circuit breaker that stops polling an exchange after its requests keep failing.
+// While it's open, the last quotes fetched from the exchange are served marked stale, and once
+// the cooldown has passed a single request is let through to check whether it has recovered
+type Breaker struct {
+	sync.Mutex
+	exchange string
+	limit    int
+	cooldown time.Duration
+	state    BreakerState
+	// since is when the breaker last changed state
+	since time.Time
+	// failures counts the requests that failed in a row, and err is the latest of their errors
+	failures int
+	err      string
+	// probing is set while a half-open breaker's request is in flight
+	probing bool
+	// last holds the latest quote fetched successfully for each pair
+	last map[Pair]Quote
+}
+
+// NewBreaker returns a closed breaker for an exchange
+func NewBreaker(exchange string, c BreakerConfig) *Breaker {
+	limit := c.Failures
+	if limit <= 0 {
+		limit = defaultBreakerFailures
+	}
+	cooldown := c.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &Breaker{
+		exchange: exchange,
+		limit:    limit,
+		cooldown: cooldown,
+		state:    BreakerClosed,
+		since:    time.Now(),
+		last:     make(map[Pair]Quote),
+	}
+}
+
+// Allow checks whether a request can be made to the exchange. Every request that's allowed must
+// be followed by a call to Record with its outcome
+func (b *Breaker) Allow(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if now.Sub(b.since) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.since = now
+	}
+
+	// only one probe at a time, so a recovering exchange isn't hit by every pair at once
+	if b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Record updates the breaker with the outcome of a request. A success closes the breaker, while
+// a failed probe or too many failures in a row open it
+func (b *Breaker) Record(err error, now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+
+	if err == nil {
+		if b.state != BreakerClosed {
+			log.Println("circuit breaker for", b.exchange, "closed,", b.exchange, "has recovered")
+			b.state = BreakerClosed
+			b.since = now
+		}
+		b.failures = 0
+		b.err = ""
+		return
+	}
+
+	b.failures++
+	b.err = err.Error()
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.limit) {
+		log.Println("circuit breaker for", b.exchange, "opened after", b.failures, "failures, retrying in", b.cooldown, err)
+		b.state = BreakerOpen
+		b.since = now
+	}
+}
+
+// remember keeps a quote that was fetched successfully, to serve while the breaker is open
+func (b *Breaker) remember(pair Pair, quote Quote) {
+	b.Lock()
+	defer b.Unlock()
+	b.last[pair] = quote
+}
+
+// cached returns the last quote fetched for a pair marked stale, or an error quote if there isn't one
+func (b *Breaker) cached(pair Pair) Quote {
+	b.Lock()
+	defer b.Unlock()
+	reason := "circuit breaker open after " + strconv.Itoa(b.failures) + " failures: " + b.err
+	quote, ok := b.last[pair]
+	if !ok {
+		return Quote{Status: StatusError, Error: reason, Time: time.Now()}
+	}
+	quote.Status = StatusStale
+	quote.Error = reason
+	return quote
+}
+
+// BreakerStatus is the state of an exchange's circuit breaker
+type BreakerStatus struct {
+	Exchange string       `json:"exchange"`
+	State    BreakerState `json:"state"`
+	Since    time.Time    `json:"since"`
+	// Failures is how many requests have failed in a row, and Error is the latest of their errors
+	Failures int    `json:"failures"`
+	Error    string `json:"error,omitempty"`
+	// Retry is when an open breaker lets a request through to probe the exchange
+	Retry *time.Time `json:"retry,omitempty"`
+}
+
+// Status returns the current state of the breaker
+func (b *Breaker) Status() BreakerStatus {
+	b.Lock()
+	defer b.Unlock()
+	status := BreakerStatus{Exchange: b.exchange, State: b.state, Since: b.since, Failures: b.failures, Error: b.err}
+	if b.state == BreakerOpen {
+		retry := b.since.Add(b.cooldown)
+		status.Retry = &retry
+	}
+	return status
+}
+
+// breakers holds the circuit breaker for each exchange, keyed by lowercase name. It's set up
+// when the config is loaded and only read afterwards
+var breakers = make(map[string]*Breaker)
+
+// setupBreakers creates a circuit breaker for every known exchange
+func setupBreakers(c BreakerConfig) {
+	list := make(map[string]*Breaker)
+	for name, exchange := range registry {
+		list[name] = NewBreaker(exchange.Name(), c)
+	}
+	breakers = list
+}
+
+// lookupBreaker returns the circuit breaker of an exchange
+func lookupBreaker(exchange string) (*Breaker, bool) {
+	breaker, ok := breakers[strings.ToLower(exchange)]
+	return breaker, ok
+}
+
+// breakerStatus returns the state of an exchange's circuit breaker. Exchanges without one are always closed
+func breakerStatus(exchange string) BreakerStatus {
+	if breaker, ok := lookupBreaker(exchange); ok {
+		return breaker.Status()
+	}
+	return BreakerStatus{Exchange: exchange, State: BreakerClosed}
+}
+
+// breakerStatuses returns the state of the circuit breaker of every exchange the dashboard queries
+func breakerStatuses() []BreakerStatus {
+	list := make([]BreakerStatus, len(exchanges))
+	for i, exchange := range exchanges {
+		list[i] = breakerStatus(exchange.Name())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Exchange < list[j].Exchange })
+	return list
+}
+
+var breakerDesc = prometheus.NewDesc("demodash_circuit_breaker_state", "Whether an exchange's circuit breaker is in the given state.",
+	[]string{"exchange", "state"}, nil)
+
+func init() {
+	prometheus.MustRegister(breakerCollector{})
+}
+
+// breakerCollector exports the state of each exchange's circuit breaker when metrics are scraped
+type breakerCollector struct{}
+
+// Describe sends the description of the breaker metric
+func (breakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- breakerDesc
+}
+
+// Collect sends a series for every state of each breaker, set to 1 for the breaker's current state
+func (breakerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, status := range breakerStatuses() {
+		for _, state := range breakerStates {
+			value := 0.0
+			if status.State == state {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(breakerDesc, prometheus.GaugeValue, value, status.Exchange, string(state))
+		}
+	}
+}
+
+// BreakersResponse is the response to /api/v1/breakers
+type BreakersResponse struct {
+	Breakers []BreakerStatus `json:"breakers"`
+}
+
+// getBreakers serves /api/v1/breakers, showing the state of each exchange's circuit breaker
+func getBreakers() {
+	http.HandleFunc("/api/v1/breakers", func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+		writeJSON(w, BreakersResponse{Breakers: breakerStatuses()})
+	})
+}
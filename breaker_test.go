@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// openBreaker returns a breaker for Kraken that was opened by failures at start
+func openBreaker(t *testing.T, start time.Time) *Breaker {
+	t.Helper()
+	b := NewBreaker("Kraken", BreakerConfig{Failures: 2, Cooldown: time.Minute})
+	for i := 0; i < 2; i++ {
+		if !b.Allow(start) {
+			t.Fatal("closed breaker turned a request away")
+		}
+		b.Record(errors.New("got status 502"), start)
+	}
+	if status := b.Status(); status.State != BreakerOpen || status.Failures != 2 {
+		t.Fatalf("got breaker %+v after two failures, want it open", status)
+	}
+	return b
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	start := time.Now()
+	b := openBreaker(t, start)
+	if b.Allow(start.Add(59 * time.Second)) {
+		t.Error("open breaker let a request through before the cooldown")
+	}
+	if status := b.Status(); status.Retry == nil || !status.Retry.Equal(start.Add(time.Minute)) {
+		t.Errorf("got retry %v, want a minute after opening", status.Retry)
+	}
+
+	// once the cooldown is up a single probe is let through, however many requests are waiting
+	if !b.Allow(start.Add(time.Minute)) {
+		t.Fatal("breaker didn't let a probe through after the cooldown")
+	}
+	if status := b.Status(); status.State != BreakerHalfOpen || status.Retry != nil {
+		t.Errorf("got breaker %+v while probing, want it half-open", status)
+	}
+	if b.Allow(start.Add(time.Minute)) || b.Allow(start.Add(2*time.Minute)) {
+		t.Error("half-open breaker let a second probe through")
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		err    error
+		state  BreakerState
+		failed int
+	}{
+		{"succeeds", nil, BreakerClosed, 0},
+		{"fails", errors.New("timeout"), BreakerOpen, 3},
+	} {
+		start := time.Now()
+		b := openBreaker(t, start)
+		probed := start.Add(time.Minute)
+		b.Allow(probed)
+		b.Record(test.err, probed)
+
+		status := b.Status()
+		if status.State != test.state || status.Failures != test.failed || !status.Since.Equal(probed) {
+			t.Errorf("probe %s: got breaker %+v, want %s with %d failures", test.name, status, test.state, test.failed)
+		}
+		// a closed breaker lets everything through, while a reopened one waits out another cooldown
+		allowed := b.Allow(probed.Add(time.Second))
+		if allowed != (test.state == BreakerClosed) {
+			t.Errorf("probe %s: breaker allowed a request: %v", test.name, allowed)
+		}
+		if test.state == BreakerOpen && !b.Allow(probed.Add(time.Minute)) {
+			t.Errorf("probe %s: breaker didn't probe again after another cooldown", test.name)
+		}
+	}
+}
+
+func TestBreakerCachedQuotes(t *testing.T) {
+	b := openBreaker(t, time.Now())
+	b.remember(btcUSD, NewQuote(100, 1))
+
+	quote := b.cached(btcUSD)
+	if quote.Status != StatusStale || quote.Price != 100 || quote.Error != "circuit breaker open after 2 failures: got status 502" {
+		t.Errorf("got cached quote %+v", quote)
+	}
+	if quote := b.cached(ethUSD); quote.Status != StatusError {
+		t.Errorf("got quote %+v for a pair that was never fetched", quote)
+	}
+}
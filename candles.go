@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// candlesBucket is the bucket holding a nested bucket of candles for each exchange, pair and interval
+var candlesBucket = []byte("candles")
+
+// intervals are the candle intervals that quotes are rolled up into
+var intervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// Candle is the open, high, low, close and volume of a pair on an exchange over an interval
+type Candle struct {
+	Time  time.Time `json:"time"` // the start of the interval
+	Open  float64   `json:"open"`
+	High  float64   `json:"high"`
+	Low   float64   `json:"low"`
+	Close float64   `json:"close"`
+	// Volume is only known for candles backfilled from the exchanges, and is left out of candles
+	// rolled up from live quotes
+	Volume float64 `json:"volume,omitempty"`
+}
+
+// candleKey is the name of the bucket holding the candles for a pair on an exchange
+func candleKey(exchange string, pair Pair, interval string) []byte {
+	return append(seriesKey(exchange, pair), []byte("/"+interval)...)
+}
+
+// addQuote updates a candle with a quote that falls in its interval. Tickers only report the
+// rolling 24 hour volume, which says nothing about how much traded within the interval, so the
+// candle's volume is left as it is
+func (c *Candle) addQuote(quote Quote, interval time.Duration) {
+	if c.Time.IsZero() {
+		c.Time = quote.Time.Truncate(interval)
+		c.Open = quote.Price
+		c.High = quote.Price
+		c.Low = quote.Price
+	}
+	if quote.Price > c.High {
+		c.High = quote.Price
+	}
+	if quote.Price < c.Low {
+		c.Low = quote.Price
+	}
+	c.Close = quote.Price
+}
+
+// updateCandles rolls a quote up into the candle for each interval
+func updateCandles(tx *bolt.Tx, exchange string, pair Pair, quote Quote) error {
+	root, err := tx.CreateBucketIfNotExists(candlesBucket)
+	if err != nil {
+		return err
+	}
+
+	for name, interval := range intervals {
+		series, err := root.CreateBucketIfNotExists(candleKey(exchange, pair, name))
+		if err != nil {
+			return err
+		}
+
+		key := timeKey(quote.Time.Truncate(interval))
+		var candle Candle
+		if data := series.Get(key); data != nil {
+			err = json.Unmarshal(data, &candle)
+			if err != nil {
+				return err
+			}
+		}
+
+		candle.addQuote(quote, interval)
+		data, err := json.Marshal(candle)
+		if err != nil {
+			return err
+		}
+		err = series.Put(key, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Candles returns the candles for a pair on an exchange that open between from and to, oldest first
+func (h *History) Candles(exchange string, pair Pair, interval string, from time.Time, to time.Time) ([]Candle, error) {
+	var list []Candle
+	err := h.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(candlesBucket)
+		if root == nil {
+			return nil
+		}
+		series := root.Bucket(candleKey(exchange, pair, interval))
+		if series == nil {
+			return nil
+		}
+
+		c := series.Cursor()
+		end := timeKey(to)
+		for k, v := c.Seek(timeKey(from)); k != nil && string(k) <= string(end); k, v = c.Next() {
+			var candle Candle
+			err := json.Unmarshal(v, &candle)
+			if err != nil {
+				return err
+			}
+			list = append(list, candle)
+		}
+		return nil
+	})
+	return list, err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testHistory opens a history database in a temporary directory
+func testHistory(t *testing.T) *History {
+	t.Helper()
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestRecordCandles(t *testing.T) {
+	h := testHistory(t)
+	start := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	for i, price := range []float64{100, 104, 98, 101} {
+		quote := NewQuote(price, 5000+float64(i))
+		quote.Time = start.Add(time.Duration(i) * 10 * time.Second)
+		snapshot := NewSnapshot(quote.Time)
+		snapshot.set("Kraken", btcUSD, quote)
+		err := h.Record(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	candles, err := h.Candles("Kraken", btcUSD, "1m", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 1 {
+		t.Fatalf("got %d candles, want 1", len(candles))
+	}
+	want := Candle{Time: start, Open: 100, High: 104, Low: 98, Close: 101}
+	if !candles[0].Time.Equal(want.Time) || candles[0].Open != want.Open || candles[0].High != want.High ||
+		candles[0].Low != want.Low || candles[0].Close != want.Close {
+		t.Errorf("got candle %+v, want %+v", candles[0], want)
+	}
+	// the tickers' rolling 24 hour volume doesn't say how much traded in the minute
+	if candles[0].Volume != 0 {
+		t.Errorf("got volume %v for a candle built from live quotes", candles[0].Volume)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	erpc "github.com/Varunram/essentials/rpc"
+)
+
+// ChartPeriod is a time range that can be charted and the candle interval used to draw it
+type ChartPeriod struct {
+	Name     string
+	Length   time.Duration
+	Interval string
+}
+
+// chartPeriods are the periods that can be picked on the chart page. The first one is the default
+var chartPeriods = []ChartPeriod{
+	{Name: "24h", Length: 24 * time.Hour, Interval: "5m"},
+	{Name: "1h", Length: time.Hour, Interval: "1m"},
+	{Name: "7d", Length: 7 * 24 * time.Hour, Interval: "1h"},
+	{Name: "30d", Length: 30 * 24 * time.Hour, Interval: "1h"},
+	{Name: "1y", Length: 365 * 24 * time.Hour, Interval: "1d"},
+}
+
+// chartColors are the line colours given to exchanges, in the order they appear in the config
+var chartColors = []string{"#ffffff", "#2b2d42", "#ffd166", "#06d6a0", "#118ab2", "#8338ec"}
+
+const (
+	chartWidth   = 800
+	chartHeight  = 360
+	chartPadding = 60
+)
+
+// ChartSeries is the closing prices of a pair on a single exchange
+type ChartSeries struct {
+	Exchange string
+	Color    string
+	Candles  []Candle
+}
+
+// Chart is a price chart of a single pair across exchanges
+type Chart struct {
+	Pair Pair
+	SVG  template.HTML
+}
+
+// ChartPage is the structure used to feed data to the chart page
+type ChartPage struct {
+	Asset   string
+	Period  string
+	Periods []ChartPeriod
+	Charts  []Chart
+	Message string
+}
+
+// lookupPeriod finds a chart period by name, returning the default period if name is empty
+func lookupPeriod(name string) (ChartPeriod, bool) {
+	if name == "" {
+		return chartPeriods[0], true
+	}
+	for _, period := range chartPeriods {
+		if period.Name == name {
+			return period, true
+		}
+	}
+	return ChartPeriod{}, false
+}
+
+// chartSeries reads the candles for a pair on every exchange that lists it from history
+func chartSeries(h *History, pair Pair, period ChartPeriod, now time.Time) ([]ChartSeries, error) {
+	var list []ChartSeries
+	for i, exchange := range exchanges {
+		if !listed(exchange, pair.Base) {
+			continue
+		}
+
+		candles, err := h.Candles(exchange.Name(), pair, period.Interval, now.Add(-period.Length), now)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ChartSeries{
+			Exchange: exchange.Name(),
+			Color:    chartColors[i%len(chartColors)],
+			Candles:  candles,
+		})
+	}
+	return list, nil
+}
+
+// renderChart draws the series as an SVG line chart between from and to, scaled to the range of prices
+func renderChart(series []ChartSeries, from time.Time, to time.Time) template.HTML {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, candle := range s.Candles {
+			low = math.Min(low, candle.Close)
+			high = math.Max(high, candle.Close)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="chart" viewBox="0 0 %d %d">`, chartWidth, chartHeight)
+	if math.IsInf(low, 1) {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">no history recorded yet</text></svg>`, chartWidth/2, chartHeight/2)
+		return template.HTML(b.String())
+	}
+	if high == low {
+		// pad a flat line so it's drawn in the middle of the chart
+		high, low = high*1.001+1e-9, low*0.999-1e-9
+	}
+
+	plotWidth := float64(chartWidth - 2*chartPadding)
+	plotHeight := float64(chartHeight - 2*chartPadding)
+	x := func(t time.Time) float64 {
+		return chartPadding + plotWidth*float64(t.Sub(from))/float64(to.Sub(from))
+	}
+	y := func(price float64) float64 {
+		return chartPadding + plotHeight*(high-price)/(high-low)
+	}
+
+	// axes, with the price range on the left and the time range along the bottom
+	fmt.Fprintf(&b, `<rect class="plot" x="%d" y="%d" width="%g" height="%g"/>`, chartPadding, chartPadding, plotWidth, plotHeight)
+	for _, price := range []float64{high, (high + low) / 2, low} {
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%.6g</text>`, chartPadding-6, y(price)+4, price)
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="start">%s</text>`, chartPadding, chartHeight-chartPadding+18, from.UTC().Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartWidth-chartPadding, chartHeight-chartPadding+18, to.UTC().Format("2006-01-02 15:04"))
+
+	for i, s := range series {
+		points := make([]string, len(s.Candles))
+		for j, candle := range s.Candles {
+			points[j] = fmt.Sprintf("%.1f,%.1f", x(candle.Time), y(candle.Close))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, s.Color, strings.Join(points, " "))
+
+		// legend along the top
+		lx := chartPadding + i*120
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, lx, chartPadding-30, s.Color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, lx+18, chartPadding-19, s.Exchange)
+	}
+
+	b.WriteString("</svg>")
+	// the chart is built from numbers and exchange names, so it's safe to include as is
+	return template.HTML(b.String())
+}
+
+// buildChartPage draws a chart from history for each pair of an asset
+func buildChartPage(h *History, asset string, period ChartPeriod) (ChartPage, error) {
+	page := ChartPage{Asset: asset, Period: period.Name, Periods: chartPeriods}
+	if h == nil {
+		page.Message = "Charts need history to be enabled in the config"
+		return page, nil
+	}
+
+	now := time.Now()
+	for _, pair := range config.Pairs() {
+		if pair.Base != asset {
+			continue
+		}
+
+		series, err := chartSeries(h, pair, period, now)
+		if err != nil {
+			return page, err
+		}
+		page.Charts = append(page.Charts, Chart{Pair: pair, SVG: renderChart(series, now.Add(-period.Length), now)})
+	}
+	return page, nil
+}
+
+// serveCharts serves a page of price charts for an asset on /chart/{asset}?period=24h
+func serveCharts() {
+	http.HandleFunc("/chart/", func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+
+		asset := strings.ToUpper(strings.Trim(strings.TrimPrefix(req.URL.Path, "/chart/"), "/"))
+		if !contains(config.Assets, asset) {
+			erpc.ResponseHandler(w, erpc.StatusNotFound, "asset not found")
+			return
+		}
+		period, ok := lookupPeriod(req.URL.Query().Get("period"))
+		if !ok {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest, "unknown period")
+			return
+		}
+
+		doc, err := ioutil.ReadFile("chart.html")
+		if err != nil {
+			log.Println(err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError, APIError)
+			return
+		}
+		templates := template.New("template")
+		templates.New("doc").Parse(string(doc))
+
+		page, err := buildChartPage(history, asset, period)
+		if err != nil {
+			log.Println(err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError, APIError)
+			return
+		}
+		templates.Lookup("doc").Execute(w, page)
+	})
+}
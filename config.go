@@ -0,0 +1,249 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"time"
+
+	errors "github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config is the structure of the config file passed to the server
+type Config struct {
+	// Assets are the coins displayed on the dashboard
+	Assets []string `yaml:"assets"`
+	// Quotes are the currencies each asset is priced in
+	Quotes []string `yaml:"quotes"`
+	// Exchanges are the names of the exchanges to query
+	Exchanges []string `yaml:"exchanges"`
+	// Listings override the coins listed on each exchange, so new assets can be added without a code change
+	Listings map[string][]string `yaml:"listings"`
+	// Interval is how often the exchanges are polled for new data
+	Interval time.Duration `yaml:"interval"`
+	// Stale is how old a quote can get before it's marked stale. Defaults to three intervals
+	Stale time.Duration `yaml:"stale"`
+	// Stream subscribes to the websocket feeds of exchanges that have them instead of polling them
+	Stream bool `yaml:"stream"`
+	// History configures where quotes are recorded. Quotes aren't recorded if no path is set
+	History HistoryConfig `yaml:"history"`
+	// Arbitrage configures when a spread between exchanges is flagged
+	Arbitrage ArbitrageConfig `yaml:"arbitrage"`
+	// Index configures how the composite price of each pair is computed
+	Index IndexConfig `yaml:"index"`
+	// Outliers configures when a quote is too far from the other exchanges to be trusted
+	Outliers OutlierConfig `yaml:"outliers"`
+	// Alerts are the rules that raise alerts and how often they can fire
+	Alerts AlertsConfig `yaml:"alerts"`
+	// Notify sets where alerts are sent
+	Notify NotifyConfig `yaml:"notify"`
+	// Limits override the default request budget of each exchange
+	Limits map[string]LimitConfig `yaml:"limits"`
+	// Timeout is how long a single request to an exchange can take. Defaults to 10s
+	Timeout time.Duration `yaml:"timeout"`
+	// Timeouts override the timeout for individual exchanges
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+	// Breaker configures when polling an exchange is paused because its requests keep failing
+	Breaker BreakerConfig `yaml:"breaker"`
+}
+
+// HistoryConfig is the history section of the config file
+type HistoryConfig struct {
+	// Path is the location of the history database
+	Path string `yaml:"path"`
+	// Retention is how long quotes are kept for. Quotes are kept forever if it isn't set
+	Retention time.Duration `yaml:"retention"`
+}
+
+// ArbitrageConfig is the arbitrage section of the config file
+type ArbitrageConfig struct {
+	// Threshold is the percentage a spread has to exceed after fees to be flagged
+	Threshold float64 `yaml:"threshold"`
+	// Fees are the taker fees of each exchange as a percentage of the trade
+	Fees map[string]float64 `yaml:"fees"`
+}
+
+// IndexConfig is the index section of the config file
+type IndexConfig struct {
+	// Method is vwap, median or trimmed. Defaults to median
+	Method string `yaml:"method"`
+	// Trim is the fraction of prices dropped from each end for the trimmed mean. Defaults to 0.25
+	// if it isn't set, while 0 gives the plain mean
+	Trim *float64 `yaml:"trim"`
+}
+
+// OutlierConfig is the outliers section of the config file. A limit of zero disables that check
+type OutlierConfig struct {
+	// Deviations is how many standard deviations of the other exchanges' prices a quote can be from the median
+	Deviations float64 `yaml:"deviations"`
+	// Percent is how far a quote can be from the median as a percentage of the median
+	Percent float64 `yaml:"percent"`
+}
+
+// config is the config the server was started with
+var config Config
+
+// loadConfig reads the config file at path and sets up the exchanges to query
+func loadConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "could not read config file")
+	}
+
+	var c Config
+	err = yaml.Unmarshal(data, &c)
+	if err != nil {
+		return errors.Wrap(err, "could not parse config file")
+	}
+
+	if len(c.Assets) == 0 || len(c.Quotes) == 0 || len(c.Exchanges) == 0 {
+		return errors.New("config needs at least one asset, quote currency and exchange")
+	}
+
+	for i := range c.Assets {
+		c.Assets[i] = strings.ToUpper(c.Assets[i])
+	}
+	for i := range c.Quotes {
+		c.Quotes[i] = strings.ToUpper(c.Quotes[i])
+	}
+
+	listings := make(map[string][]string)
+	for name, coins := range c.Listings {
+		if _, ok := lookupExchange(name); !ok {
+			return errors.New("unknown exchange in listings: " + name)
+		}
+		for i := range coins {
+			coins[i] = strings.ToUpper(coins[i])
+		}
+		listings[strings.ToLower(name)] = coins
+	}
+	c.Listings = listings
+
+	c.Index.Method = strings.ToLower(c.Index.Method)
+	if c.Index.Method == "" {
+		c.Index.Method = IndexMedian
+	}
+	if !contains(indexMethods, c.Index.Method) {
+		return errors.New("unknown index method in config: " + c.Index.Method)
+	}
+	if c.Index.Trim != nil && (*c.Index.Trim < 0 || *c.Index.Trim >= 0.5) {
+		return errors.New("index trim must be between 0 and 0.5")
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Alerts.Rules {
+		err = c.Alerts.Rules[i].check()
+		if err != nil {
+			return err
+		}
+		if names[c.Alerts.Rules[i].Name] {
+			return errors.New("duplicate alert rule: " + c.Alerts.Rules[i].Name)
+		}
+		names[c.Alerts.Rules[i].Name] = true
+	}
+
+	if c.Notify.Retries != nil && *c.Notify.Retries < 0 {
+		return errors.New("notify retries can't be negative")
+	}
+	for _, webhook := range c.Notify.Webhooks {
+		if webhook.URL == "" {
+			return errors.New("webhooks need a url")
+		}
+	}
+	if c.Notify.Email.Host != "" && (c.Notify.Email.From == "" || len(c.Notify.Email.To) == 0) {
+		return errors.New("email notifications need a from address and at least one to address")
+	}
+
+	limits := make(map[string]LimitConfig)
+	for name, limit := range c.Limits {
+		if _, ok := lookupExchange(name); !ok {
+			return errors.New("unknown exchange in limits: " + name)
+		}
+		if limit.Requests <= 0 || limit.Per <= 0 {
+			return errors.New("limit for " + name + " needs requests and per to be set")
+		}
+		limits[strings.ToLower(name)] = limit
+	}
+	c.Limits = limits
+
+	if c.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+	timeouts := make(map[string]time.Duration)
+	for name, timeout := range c.Timeouts {
+		if _, ok := lookupExchange(name); !ok {
+			return errors.New("unknown exchange in timeouts: " + name)
+		}
+		if timeout <= 0 {
+			return errors.New("timeout for " + name + " needs to be positive")
+		}
+		timeouts[strings.ToLower(name)] = timeout
+	}
+	c.Timeouts = timeouts
+
+	if c.Breaker.Failures < 0 || c.Breaker.Cooldown < 0 {
+		return errors.New("breaker failures and cooldown can't be negative")
+	}
+
+	fees := make(map[string]float64)
+	for name, fee := range c.Arbitrage.Fees {
+		fees[strings.ToLower(name)] = fee
+	}
+	c.Arbitrage.Fees = fees
+
+	var list []Exchange
+	for _, name := range c.Exchanges {
+		exchange, ok := lookupExchange(name)
+		if !ok {
+			return errors.New("unknown exchange in config: " + name)
+		}
+		list = append(list, exchange)
+	}
+
+	config = c
+	exchanges = list
+	setupLimiters(c.Limits)
+	setupBreakers(c.Breaker)
+	return nil
+}
+
+// Pairs returns every combination of the configured assets and quote currencies
+func (c Config) Pairs() []Pair {
+	var pairs []Pair
+	for _, asset := range c.Assets {
+		for _, quote := range c.Quotes {
+			pairs = append(pairs, Pair{Base: asset, Quote: quote})
+		}
+	}
+	return pairs
+}
+
+// interval returns the polling interval, falling back to the default if it isn't set
+func (c Config) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultInterval
+	}
+	return c.Interval
+}
+
+// staleAfter returns how old a quote can get before it's marked stale
+func (c Config) staleAfter() time.Duration {
+	if c.Stale <= 0 {
+		return 3 * c.interval()
+	}
+	return c.Stale
+}
+
+// trim returns the fraction of prices dropped from each end for the trimmed mean, falling back
+// to the default if it isn't set
+func (c Config) trim() float64 {
+	if c.Index.Trim == nil {
+		return defaultTrim
+	}
+	return *c.Index.Trim
+}
+
+// fee returns the taker fee of an exchange as a fraction of the trade
+func (c Config) fee(exchange string) float64 {
+	return c.Arbitrage.Fees[strings.ToLower(exchange)] / 100
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	errors "github.com/pkg/errors"
+)
+
+// emailTimeout is how long a session with the SMTP server can take, from connecting to sending
+// the message
+var emailTimeout = 10 * time.Second
+
+// EmailConfig is the email section of the notify config
+type EmailConfig struct {
+	Host string `yaml:"host"`
+	// Port defaults to 587
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// StartTLS upgrades the connection with STARTTLS before authenticating
+	StartTLS bool     `yaml:"starttls"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// EmailNotifier sends alerts as emails over SMTP
+type EmailNotifier struct {
+	config EmailConfig
+	// tlsConfig is used to upgrade the connection if StartTLS is set
+	tlsConfig *tls.Config
+}
+
+// NewEmailNotifier returns a notifier sending mail through the SMTP server in c
+func NewEmailNotifier(c EmailConfig) *EmailNotifier {
+	if c.Port == 0 {
+		c.Port = 587
+	}
+	return &EmailNotifier{config: c, tlsConfig: &tls.Config{ServerName: c.Host}}
+}
+
+// Name returns the SMTP server's address
+func (n *EmailNotifier) Name() string {
+	return "email via " + n.address()
+}
+
+// address returns the host and port of the SMTP server
+func (n *EmailNotifier) address() string {
+	return net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+}
+
+// emailRow is a quote shown in the body of an alert email, named by its exchange or its pair
+type emailRow struct {
+	Name  string
+	Quote Quote
+}
+
+// emailBody is the data the email templates are filled in with. Alerts about a pair list its quote
+// on every exchange, while alerts about an exchange list its quote for every pair
+type emailBody struct {
+	Alert Alert
+	// Title is the pair or exchange the quotes are for, and Column is what the rows are named by
+	Title  string
+	Column string
+	Rows   []emailRow
+}
+
+// emailText is the plain text body of alert emails
+var emailText = texttemplate.Must(texttemplate.New("text").Parse(`Alert {{.Alert.State}}: {{.Alert.Rule}}
+
+{{.Alert.Message}}
+Since {{.Alert.Since.UTC.Format "2006-01-02 15:04:05"}} UTC
+
+Latest {{.Title}} quotes:
+{{range .Rows}}  {{.Name}}: {{if .Quote.Available}}{{.Quote.Price}} ({{.Quote.Status}}){{else}}{{.Quote.Status}}{{with .Quote.Error}}: {{.}}{{end}}{{end}}
+{{end}}`))
+
+// emailHTML is the HTML body of alert emails
+var emailHTML = template.Must(template.New("html").Parse(`<html><body>
+<h2>Alert {{.Alert.State}}: {{.Alert.Rule}}</h2>
+<p>{{.Alert.Message}}<br>Since {{.Alert.Since.UTC.Format "2006-01-02 15:04:05"}} UTC</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>{{.Column}}</th><th>{{.Title}} price</th><th>Volume</th><th>Status</th></tr>
+{{range .Rows}}<tr><td>{{.Name}}</td>{{if .Quote.Available}}<td>{{.Quote.Price}}</td><td>{{.Quote.Volume}}</td>{{else}}<td colspan="2">{{.Quote.Error}}</td>{{end}}<td>{{.Quote.Status}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// Notify emails an alert along with the latest quotes for its pair or exchange
+func (n *EmailNotifier) Notify(ctx context.Context, alert Alert) error {
+	message, err := n.message(alert, store.Snapshot(), time.Now())
+	if err != nil {
+		return err
+	}
+	return retry(ctx, n.Name(), func() error {
+		return n.send(ctx, message)
+	})
+}
+
+// message builds an alert email with a plain text and an HTML body
+func (n *EmailNotifier) message(alert Alert, snapshot *Snapshot, now time.Time) ([]byte, error) {
+	body := emailBody{Alert: alert}
+	if alert.Asset == "" {
+		body.Title, body.Column = alert.Exchange, "Pair"
+		if exchange, ok := lookupExchange(alert.Exchange); ok {
+			for _, pair := range config.Pairs() {
+				if listed(exchange, pair.Base) {
+					body.Rows = append(body.Rows, emailRow{Name: pair.String(), Quote: lookupQuote(snapshot, exchange, pair)})
+				}
+			}
+		}
+	} else {
+		pair := Pair{Base: alert.Asset, Quote: alert.Quote}
+		body.Title, body.Column = pair.String(), "Exchange"
+		for _, exchange := range exchanges {
+			if listed(exchange, alert.Asset) {
+				body.Rows = append(body.Rows, emailRow{Name: exchange.Name(), Quote: lookupQuote(snapshot, exchange, pair)})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	subject := "[demodash] " + strings.ToUpper(alert.State) + ": " + alert.Message
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+
+	for _, part := range []struct {
+		contentType string
+		execute     func(io.Writer) error
+	}{
+		{"text/plain", func(w io.Writer) error { return emailText.Execute(w, body) }},
+		{"text/html", func(w io.Writer) error { return emailHTML.Execute(w, body) }},
+	} {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", part.contentType+"; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		w, err := parts.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		err = part.execute(qp)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not render email")
+		}
+		qp.Close()
+	}
+
+	err := parts.Close()
+	return buf.Bytes(), err
+}
+
+// send makes a single attempt at delivering a message through the SMTP server
+func (n *EmailNotifier) send(ctx context.Context, message []byte) error {
+	dialer := net.Dialer{Timeout: emailTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.address())
+	if err != nil {
+		return errors.Wrap(err, "could not connect to SMTP server")
+	}
+
+	// the deadline covers the whole session, so a server that stalls after accepting the connection
+	// can't hold up the notifier for good. Closing the connection stops the session early on shutdown
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "could not start SMTP session")
+	}
+	defer client.Close()
+
+	if n.config.StartTLS {
+		err = client.StartTLS(n.tlsConfig)
+		if err != nil {
+			return smtpError(err, "STARTTLS failed")
+		}
+	}
+	if n.config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host))
+		if err != nil {
+			return smtpError(err, "SMTP authentication failed")
+		}
+	}
+
+	err = client.Mail(n.config.From)
+	if err != nil {
+		return smtpError(err, "SMTP server rejected sender")
+	}
+	for _, to := range n.config.To {
+		err = client.Rcpt(to)
+		if err != nil {
+			return smtpError(err, "SMTP server rejected recipient "+to)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return smtpError(err, "could not send email")
+	}
+	_, err = w.Write(message)
+	if err != nil {
+		return errors.Wrap(err, "could not send email")
+	}
+	err = w.Close()
+	if err != nil {
+		return smtpError(err, "could not send email")
+	}
+	return client.Quit()
+}
+
+// smtpError wraps an error from the SMTP server, marking permanent failures so they aren't retried
+func smtpError(err error, message string) error {
+	err = errors.Wrap(err, message)
+	if tpErr, ok := errors.Cause(err).(*textproto.Error); ok && tpErr.Code >= 500 {
+		return permanent(err)
+	}
+	return err
+}
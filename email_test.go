@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is a minimal SMTP server that records the mail it's sent. Replies to a command can be
+// overridden to test failures
+type fakeSMTP struct {
+	sync.Mutex
+	listener net.Listener
+	replies  map[string]string
+	// certificate is offered through STARTTLS if it's set, and roots is a pool that trusts it
+	certificate *tls.Certificate
+	roots       *x509.CertPool
+	// stall has the server accept connections without ever greeting the client
+	stall    bool
+	sessions int
+	secure   bool
+	from     string
+	to       []string
+	data     string
+}
+
+// startFakeSMTP starts server listening on a local port until the test ends
+func startFakeSMTP(t *testing.T, server *fakeSMTP) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.listener = listener
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// withTLS has the server offer STARTTLS, borrowing httptest's certificate for 127.0.0.1
+func (s *fakeSMTP) withTLS() *fakeSMTP {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	s.certificate = &server.TLS.Certificates[0]
+	s.roots = x509.NewCertPool()
+	s.roots.AddCert(server.Certificate())
+	return s
+}
+
+// port returns the port the server is listening on
+func (s *fakeSMTP) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// reply returns the server's reply to a command, or def if it isn't overridden
+func (s *fakeSMTP) reply(command string, def string) string {
+	if reply, ok := s.replies[command]; ok {
+		return reply
+	}
+	return def
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	s.Lock()
+	s.sessions++
+	s.Unlock()
+	if s.stall {
+		// wait for the client to give up
+		ioutil.ReadAll(conn)
+		return
+	}
+
+	text := textproto.NewConn(conn)
+	secure := false
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-localhost")
+			if s.certificate != nil && !secure {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			if s.certificate == nil {
+				text.PrintfLine("502 STARTTLS not supported")
+				continue
+			}
+			text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*s.certificate}})
+			err = tlsConn.Handshake()
+			if err != nil {
+				return
+			}
+			// the client starts over with a new EHLO on the encrypted connection
+			text = textproto.NewConn(tlsConn)
+			secure = true
+		case "AUTH":
+			text.PrintfLine("%s", s.reply(command, "235 2.7.0 authenticated"))
+		case "MAIL":
+			reply := s.reply(command, "250 OK")
+			if strings.HasPrefix(reply, "250") {
+				s.Lock()
+				s.from = line
+				s.secure = secure
+				s.Unlock()
+			}
+			text.PrintfLine("%s", reply)
+		case "RCPT":
+			reply := s.reply(command, "250 OK")
+			if strings.HasPrefix(reply, "250") {
+				s.Lock()
+				s.to = append(s.to, line)
+				s.Unlock()
+			}
+			text.PrintfLine("%s", reply)
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := ioutil.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			s.Lock()
+			s.data = string(data)
+			s.Unlock()
+			text.PrintfLine("250 OK queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// testEmailNotifier returns a notifier sending through server, using STARTTLS if the server offers it
+func testEmailNotifier(server *fakeSMTP) *EmailNotifier {
+	notifier := NewEmailNotifier(EmailConfig{
+		Host:     "127.0.0.1",
+		Port:     server.port(),
+		Username: "demodash",
+		Password: "hunter2",
+		StartTLS: server.certificate != nil,
+		From:     "alerts@example.com",
+		To:       []string{"ops@example.com", "oncall@example.com"},
+	})
+	notifier.tlsConfig.RootCAs = server.roots
+	return notifier
+}
+
+// testAlert is the alert the email tests send
+var testAlert = Alert{Rule: "btc-high", State: AlertFiring, Asset: "BTC", Quote: "USD", Value: 30123.5, Message: "BTC/USD price on Kraken above 30000"}
+
+// testEmail sends an alert through a fake SMTP server
+func testEmail(t *testing.T, server *fakeSMTP) (*fakeSMTP, error) {
+	t.Helper()
+	testConfig(t, baseConfig+"notify:\n  retries: 3\n")
+	defer func(backoff time.Duration) { notifyBackoff = backoff }(notifyBackoff)
+	notifyBackoff = time.Millisecond
+	store = NewStore()
+	snapshot := NewSnapshot(time.Now())
+	snapshot.set("Kraken", btcUSD, NewQuote(30123.5, 12))
+	store.Publish(snapshot)
+
+	startFakeSMTP(t, server)
+	err := testEmailNotifier(server).Notify(context.Background(), testAlert)
+	// the server records each command before replying to it, so it's done by now. Locking lets the
+	// race detector see that
+	server.Lock()
+	server.Unlock()
+	return server, err
+}
+
+func TestEmailSend(t *testing.T) {
+	server, err := testEmail(t, &fakeSMTP{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.secure {
+		t.Error("sent over TLS without starttls set")
+	}
+	if server.from != "MAIL FROM:<alerts@example.com>" && !strings.HasPrefix(server.from, "MAIL FROM:<alerts@example.com> ") {
+		t.Errorf("got %q", server.from)
+	}
+	if len(server.to) != 2 || !strings.Contains(server.to[0], "<ops@example.com>") || !strings.Contains(server.to[1], "<oncall@example.com>") {
+		t.Errorf("got recipients %q", server.to)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(server.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "[demodash] FIRING: BTC/USD price on Kraken above 30000" {
+		t.Errorf("got subject %q, %v", subject, err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %q, %v", mediaType, err)
+	}
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	bodies := make(map[string]string)
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		// the multipart reader decodes quoted-printable parts itself
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[contentType] = string(body)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("got parts %v, want text and HTML", bodies)
+	}
+	if text := bodies["text/plain"]; !strings.Contains(text, "BTC/USD price on Kraken above 30000") || !strings.Contains(text, "Kraken: 30123.5 (ok)") {
+		t.Errorf("plain text body is missing the alert or quotes:\n%s", text)
+	}
+	if html := bodies["text/html"]; !strings.Contains(html, "<td>Kraken</td><td>30123.5</td>") {
+		t.Errorf("HTML body is missing the quotes:\n%s", html)
+	}
+}
+
+func TestEmailPermanentErrors(t *testing.T) {
+	server, err := testEmail(t, &fakeSMTP{replies: map[string]string{"RCPT": "550 5.1.1 no such user"}})
+	if err == nil || !strings.Contains(err.Error(), "no such user") {
+		t.Errorf("got error %v, want the server's rejection", err)
+	}
+	if server.sessions != 1 {
+		t.Errorf("got %d sessions, want the rejection not to be retried", server.sessions)
+	}
+}
+
+func TestEmailTransientErrors(t *testing.T) {
+	server, err := testEmail(t, &fakeSMTP{replies: map[string]string{"MAIL": "451 4.3.0 try again later"}})
+	if err == nil {
+		t.Error("no error when every attempt failed")
+	}
+	if want := config.retries() + 1; server.sessions != want {
+		t.Errorf("got %d sessions, want %d", server.sessions, want)
+	}
+}
+
+func TestEmailStartTLS(t *testing.T) {
+	server, err := testEmail(t, (&fakeSMTP{}).withTLS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !server.secure || !strings.Contains(server.data, "BTC/USD price on Kraken above 30000") {
+		t.Errorf("got secure %v and message %q, want the message sent over TLS", server.secure, server.data)
+	}
+
+	// a server that doesn't offer STARTTLS mustn't be sent the password in the clear
+	plain := startFakeSMTP(t, &fakeSMTP{})
+	notifier := testEmailNotifier(plain)
+	notifier.config.StartTLS = true
+	err = notifier.send(context.Background(), []byte("Subject: test\r\n\r\ntest\r\n"))
+	if err == nil {
+		t.Error("sent without STARTTLS when it's required")
+	}
+}
+
+func TestEmailStalledServer(t *testing.T) {
+	defer func(timeout time.Duration) { emailTimeout = timeout }(emailTimeout)
+	server := startFakeSMTP(t, &fakeSMTP{stall: true})
+	message := []byte("Subject: test\r\n\r\ntest\r\n")
+
+	// a server that accepts the connection and then says nothing runs into the session's deadline
+	emailTimeout = 100 * time.Millisecond
+	start := time.Now()
+	err := testEmailNotifier(server).send(context.Background(), message)
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("got error %v after %v from a stalled server", err, time.Since(start))
+	}
+
+	// shutting down doesn't wait for the deadline either
+	emailTimeout = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = testEmailNotifier(server).send(ctx, message)
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("got error %v after %v from a stalled server once ctx was done", err, time.Since(start))
+	}
+}
+
+func TestEmailExchangeAlert(t *testing.T) {
+	testConfig(t, baseConfig)
+	snapshot := NewSnapshot(time.Now())
+	snapshot.set("Coinbase", btcUSD, ErrorQuote(errors.New("got status 502")))
+	snapshot.set("Coinbase", ethUSD, NewQuote(2000, 1))
+
+	// alerts about an exchange list its quote for each pair it lists, rather than a pair on each exchange
+	notifier := NewEmailNotifier(EmailConfig{Host: "127.0.0.1", From: "alerts@example.com", To: []string{"ops@example.com"}})
+	alert := Alert{Rule: "unavailable", State: AlertFiring, Exchange: "Coinbase", Value: 1, Message: "Coinbase is unavailable", Since: time.Now()}
+	message, err := notifier.message(alert, snapshot, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	part, err := multipart.NewReader(msg.Body, params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := ioutil.ReadAll(part)
+	for _, line := range []string{"Latest Coinbase quotes:", "BTC/USD: error: got status 502", "ETH/USD: 2000 (ok)"} {
+		if !strings.Contains(string(text), line) {
+			t.Errorf("plain text body is missing %q:\n%s", line, text)
+		}
+	}
+	// ADA isn't listed on Coinbase
+	if strings.Contains(string(text), "ADA/USD") {
+		t.Errorf("plain text body has a pair Coinbase doesn't list:\n%s", text)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	erpc "github.com/Varunram/essentials/rpc"
+)
+
+// eventBuffer is how many updates are queued for each events client before updates are dropped
+var eventBuffer = 256
+
+// AggregateEvent is sent to events clients whenever one of a pair's quotes changes. Index and
+// Spread are nil if they can't be computed. A quote changing can make another exchange's quote
+// suspect, so the full list of suspect exchanges is sent too
+type AggregateEvent struct {
+	Pair
+	Index  *IndexPrice `json:"index"`
+	Spread *Spread     `json:"spread"`
+	// Suspect are the exchanges whose quotes for the pair are currently suspect
+	Suspect []string `json:"suspect"`
+}
+
+// sendAggregates writes the latest index price and spread of a pair as an aggregate event
+func sendAggregates(w http.ResponseWriter, pair Pair) error {
+	snapshot := store.Snapshot()
+	event := AggregateEvent{Pair: pair, Suspect: []string{}}
+	for exchange := range outliers(okQuotes(snapshot, pair)) {
+		event.Suspect = append(event.Suspect, exchange)
+	}
+	if index, ok := computeIndex(snapshot, pair); ok {
+		event.Index = &index
+	}
+	if spread, ok := computeSpread(snapshot, pair); ok {
+		event.Spread = &spread
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: aggregate\ndata: %s\n\n", data)
+	return err
+}
+
+// sendBreaker writes the state of an exchange's circuit breaker as a breaker event. Breakers only
+// change state when their exchange's quotes are fetched, so it's sent along with each quote event
+func sendBreaker(w http.ResponseWriter, exchange string) error {
+	data, err := json.Marshal(breakerStatus(exchange))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: breaker\ndata: %s\n\n", data)
+	return err
+}
+
+// serveEvents pushes quote changes to the browser as server sent events on /events
+func serveEvents() {
+	http.HandleFunc("/events", func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError, "streaming not supported")
+			return
+		}
+
+		updates := store.Subscribe(eventBuffer)
+		defer store.Unsubscribe(updates)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		flusher.Flush()
+
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case update := <-updates:
+				data, err := json.Marshal(checkUpdate(store.Snapshot(), update))
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				_, err = fmt.Fprintf(w, "event: quote\ndata: %s\n\n", data)
+				if err != nil {
+					return
+				}
+
+				err = sendBreaker(w, update.Exchange)
+				if err != nil {
+					return
+				}
+
+				// aggregates depend on every exchange's quote, so they're sent in full with each change
+				err = sendAggregates(w, update.Pair)
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
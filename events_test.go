@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventsOnce registers the events handler, since handlers can only be registered once
+var eventsOnce sync.Once
+
+// readEvent reads the next server sent event from a stream, returning its name and data
+func readEvent(t *testing.T, stream *bufio.Reader) (string, string) {
+	t.Helper()
+	var name, data string
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatal("stream ended mid event:", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			// a blank line ends the event
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	testConfig(t, baseConfig)
+	store = NewStore()
+	eventsOnce.Do(serveEvents)
+	server := httptest.NewServer(http.DefaultServeMux)
+	defer server.Close()
+
+	// the headers are only sent once the client is subscribed, so nothing published after this is missed
+	res, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("got content type %q", contentType)
+	}
+
+	snapshot := NewSnapshot(time.Now())
+	snapshot.set("Kraken", btcUSD, NewQuote(100, 1))
+	store.Publish(snapshot)
+
+	// each quote change is sent along with its exchange's breaker and its pair's aggregates
+	stream := bufio.NewReader(res.Body)
+	name, data := readEvent(t, stream)
+	var update Update
+	if err := json.Unmarshal([]byte(data), &update); name != "quote" || err != nil {
+		t.Fatalf("got %s event %s, want a quote", name, data)
+	}
+	if update.Exchange != "Kraken" || update.Pair != btcUSD || update.Ticker.Price != 100 {
+		t.Errorf("got update %+v", update)
+	}
+
+	name, data = readEvent(t, stream)
+	var breaker BreakerStatus
+	if err := json.Unmarshal([]byte(data), &breaker); name != "breaker" || err != nil || breaker.Exchange != "Kraken" {
+		t.Errorf("got %s event %s, want Kraken's breaker", name, data)
+	}
+
+	name, data = readEvent(t, stream)
+	var aggregate AggregateEvent
+	if err := json.Unmarshal([]byte(data), &aggregate); name != "aggregate" || err != nil {
+		t.Fatalf("got %s event %s, want aggregates", name, data)
+	}
+	if aggregate.Pair != btcUSD || aggregate.Index == nil || aggregate.Index.Price != 100 || aggregate.Spread != nil {
+		t.Errorf("got aggregates %s for a pair quoted on one exchange", data)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	errors "github.com/pkg/errors"
+)
+
+// Exchange is the interface that each venue implements in order to feed data to the dashboard
+type Exchange interface {
+	// Name returns the name of the exchange as displayed on the dashboard
+	Name() string
+	// Symbols returns the coins that are listed on the exchange, unless the config overrides them
+	Symbols() []string
+	// Ticker returns the price and volume of the passed pair, giving up when ctx is done
+	Ticker(ctx context.Context, pair Pair) (float64, float64, error)
+}
+
+// BatchExchange is implemented by exchanges that can fetch several pairs in a single request
+type BatchExchange interface {
+	Exchange
+	// Tickers returns a quote for each of the passed pairs that's in the exchange's response
+	Tickers(ctx context.Context, pairs []Pair) (map[Pair]Quote, error)
+}
+
+// single fetches one pair from an exchange's batch endpoint
+func single(ctx context.Context, exchange BatchExchange, pair Pair) (float64, float64, error) {
+	quotes, err := exchange.Tickers(ctx, []Pair{pair})
+	if err != nil {
+		return -1, -1, err
+	}
+	quote, ok := quotes[pair]
+	if !ok {
+		return -1, -1, errors.New("pair not found in " + exchange.Name() + " response: " + pair.String())
+	}
+	return quote.Price, quote.Volume, nil
+}
+
+// registry holds all known exchanges, keyed by the name used to refer to them in the config
+var registry = make(map[string]Exchange)
+
+// exchanges is the list of exchanges that the dashboard queries, in the order set in the config
+var exchanges []Exchange
+
+// RegisterExchange adds an exchange to the registry
+func RegisterExchange(name string, exchange Exchange) {
+	registry[strings.ToLower(name)] = exchange
+}
+
+// Exchanges returns the exchanges that the dashboard queries
+func Exchanges() []Exchange {
+	return exchanges
+}
+
+// lookupExchange returns the exchange registered under the passed name
+func lookupExchange(name string) (Exchange, bool) {
+	exchange, ok := registry[strings.ToLower(name)]
+	return exchange, ok
+}
+
+// active checks whether the exchange is one of the exchanges the dashboard queries
+func active(exchange Exchange) bool {
+	return containsExchange(exchanges, exchange)
+}
+
+// containsExchange checks whether exchange is in list
+func containsExchange(list []Exchange, exchange Exchange) bool {
+	for _, elem := range list {
+		if elem == exchange {
+			return true
+		}
+	}
+	return false
+}
+
+// listing returns the coins listed on an exchange, taken from the config if it overrides the exchange's own list
+func listing(exchange Exchange) []string {
+	if coins, ok := config.Listings[strings.ToLower(exchange.Name())]; ok {
+		return coins
+	}
+	return exchange.Symbols()
+}
+
+// listed checks whether a coin is listed on the passed exchange
+func listed(exchange Exchange, coin string) bool {
+	for _, symbol := range listing(exchange) {
+		if symbol == coin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"time"
+
+	errors "github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// quotesBucket is the bucket holding a nested bucket of quotes for each exchange and pair
+var quotesBucket = []byte("quotes")
+
+// History is an embedded time series store of the quotes shown on the dashboard
+type History struct {
+	db        *bolt.DB
+	retention time.Duration
+	// recorded holds the time of the last quote written for each series, so unchanged quotes aren't written twice
+	recorded map[string]time.Time
+}
+
+// history is the store quotes are recorded to. It's nil if history is disabled in the config
+var history *History
+
+// OpenHistory opens or creates the history database at path. Quotes older than retention are
+// pruned, a retention of zero keeps quotes forever
+func OpenHistory(path string, retention time.Duration) (*History, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open history database")
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(quotesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "could not create quotes bucket")
+	}
+
+	return &History{db: db, retention: retention, recorded: make(map[string]time.Time)}, nil
+}
+
+// Close closes the history database
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// seriesKey is the name of the bucket holding the quotes for a pair on an exchange
+func seriesKey(exchange string, pair Pair) []byte {
+	return []byte(exchange + "/" + pair.Base + "/" + pair.Quote)
+}
+
+// timeKey encodes a timestamp so that keys sort in time order
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// keyTime decodes a key created by timeKey
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+// Record writes every quote in the snapshot that hasn't been written yet and rolls them up into candles
+func (h *History) Record(snapshot *Snapshot) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		quotes := tx.Bucket(quotesBucket)
+		for exchange, pairs := range snapshot.Quotes {
+			for pair, quote := range pairs {
+				key := seriesKey(exchange, pair)
+				if quote.Time.IsZero() || !quote.Time.After(h.recorded[string(key)]) {
+					continue
+				}
+
+				series, err := quotes.CreateBucketIfNotExists(key)
+				if err != nil {
+					return err
+				}
+				data, err := json.Marshal(quote)
+				if err != nil {
+					return err
+				}
+				err = series.Put(timeKey(quote.Time), data)
+				if err != nil {
+					return err
+				}
+				h.recorded[string(key)] = quote.Time
+
+				if quote.Status == StatusOK {
+					err = updateCandles(tx, exchange, pair, quote)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Quotes returns the recorded quotes for a pair on an exchange between from and to, oldest first
+func (h *History) Quotes(exchange string, pair Pair, from time.Time, to time.Time) ([]Quote, error) {
+	var list []Quote
+	err := h.db.View(func(tx *bolt.Tx) error {
+		series := tx.Bucket(quotesBucket).Bucket(seriesKey(exchange, pair))
+		if series == nil {
+			return nil
+		}
+
+		c := series.Cursor()
+		end := timeKey(to)
+		for k, v := c.Seek(timeKey(from)); k != nil && string(k) <= string(end); k, v = c.Next() {
+			var quote Quote
+			err := json.Unmarshal(v, &quote)
+			if err != nil {
+				return err
+			}
+			list = append(list, quote)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// Prune deletes quotes that are older than the retention period. Candles are kept, since they're
+// much smaller and are what's used to look further back
+func (h *History) Prune(now time.Time) error {
+	if h.retention <= 0 {
+		return nil
+	}
+
+	cutoff := timeKey(now.Add(-h.retention))
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(quotesBucket).ForEach(func(name []byte, _ []byte) error {
+			series := tx.Bucket(quotesBucket).Bucket(name)
+			if series == nil {
+				return nil
+			}
+
+			c := series.Cursor()
+			for k, _ := c.First(); k != nil && string(k) < string(cutoff); k, _ = c.First() {
+				err := c.Delete()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// startRecorder writes the latest snapshot to history every interval and prunes old quotes until
+// ctx is done. The returned channel is closed once the recorder has written the last snapshot and
+// stopped, after which the history can be closed
+func startRecorder(ctx context.Context, h *History, interval time.Duration) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				err := h.Record(store.Snapshot())
+				if err != nil {
+					log.Println("could not record quotes", err)
+				}
+				return
+			case <-ticker.C:
+			}
+
+			err := h.Record(store.Snapshot())
+			if err != nil {
+				log.Println("could not record quotes", err)
+			}
+			err = h.Prune(time.Now())
+			if err != nil {
+				log.Println("could not prune history", err)
+			}
+		}
+	}()
+	return stopped
+}
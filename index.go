@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// IndexVWAP weights each exchange's price by its 24 hour volume
+	IndexVWAP = "vwap"
+	// IndexMedian takes the median price across exchanges
+	IndexMedian = "median"
+	// IndexTrimmed takes the mean price after dropping the highest and lowest prices
+	IndexTrimmed = "trimmed"
+)
+
+// defaultTrim is the fraction of prices the trimmed mean drops from each end if none is configured
+var defaultTrim = 0.25
+
+// indexMethods are the ways an index price can be computed
+var indexMethods = []string{IndexVWAP, IndexMedian, IndexTrimmed}
+
+// IndexPrice is a single reference price for a pair computed from the quotes on every exchange
+type IndexPrice struct {
+	Method string  `json:"method"`
+	Price  float64 `json:"price"`
+	// Exchanges are the exchanges whose quotes went into the price
+	Exchanges []string `json:"exchanges"`
+}
+
+// computeIndex computes the index price of a pair from the fresh quotes in a snapshot using the
+// configured method. false is returned if no exchange has a fresh quote
+func computeIndex(snapshot *Snapshot, pair Pair) (IndexPrice, bool) {
+	quotes := freshQuotes(snapshot, pair)
+	if len(quotes) == 0 {
+		return IndexPrice{}, false
+	}
+
+	index := IndexPrice{Method: config.Index.Method}
+	for _, quote := range quotes {
+		index.Exchanges = append(index.Exchanges, quote.Exchange)
+	}
+
+	switch config.Index.Method {
+	case IndexVWAP:
+		index.Price = vwap(quotes)
+	case IndexTrimmed:
+		index.Price = trimmedMean(prices(quotes), config.trim())
+	default:
+		index.Price = median(prices(quotes))
+	}
+	return index, true
+}
+
+// prices returns the prices of quotes in ascending order
+func prices(quotes []venueQuote) []float64 {
+	list := make([]float64, len(quotes))
+	for i, quote := range quotes {
+		list[i] = quote.Price
+	}
+	sort.Float64s(list)
+	return list
+}
+
+// vwap averages the prices of quotes weighted by their volume, falling back to the plain
+// mean if none of them report any volume
+func vwap(quotes []venueQuote) float64 {
+	var sum, volume float64
+	for _, quote := range quotes {
+		sum += quote.Price * quote.Volume
+		volume += quote.Volume
+	}
+	if volume <= 0 {
+		return trimmedMean(prices(quotes), 0)
+	}
+	return sum / volume
+}
+
+// median returns the middle of a sorted list of prices
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// trimmedMean averages a sorted list of prices after dropping the trim fraction from each end
+func trimmedMean(sorted []float64, trim float64) float64 {
+	drop := int(math.Floor(float64(len(sorted)) * trim))
+	sorted = sorted[drop : len(sorted)-drop]
+
+	var sum float64
+	for _, price := range sorted {
+		sum += price
+	}
+	return sum / float64(len(sorted))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMedian(t *testing.T) {
+	for _, test := range []struct {
+		sorted []float64
+		want   float64
+	}{
+		{[]float64{7}, 7},
+		{[]float64{1, 2, 10}, 2},
+		{[]float64{1, 2, 3, 10}, 2.5},
+		{[]float64{1, 4}, 2.5},
+	} {
+		if got := median(test.sorted); got != test.want {
+			t.Errorf("median of %v = %v, want %v", test.sorted, got, test.want)
+		}
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	for _, test := range []struct {
+		sorted []float64
+		trim   float64
+		want   float64
+	}{
+		{[]float64{1, 2, 3, 10}, 0, 4},
+		// a quarter of four prices is one from each end
+		{[]float64{1, 2, 3, 10}, 0.25, 2.5},
+		// a quarter of three rounds down to none
+		{[]float64{1, 2, 9}, 0.25, 4},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 100}, 0.25, 4.5},
+		// just under half still leaves the middle price
+		{[]float64{1, 2, 4, 100}, 0.49, 3},
+		{[]float64{1, 2, 100}, 0.49, 2},
+	} {
+		if got := trimmedMean(test.sorted, test.trim); got != test.want {
+			t.Errorf("trimmed mean of %v by %v = %v, want %v", test.sorted, test.trim, got, test.want)
+		}
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	quotes := []venueQuote{
+		{Exchange: "Kraken", Quote: NewQuote(100, 3)},
+		{Exchange: "Binance", Quote: NewQuote(200, 1)},
+	}
+	if got := vwap(quotes); got != 125 {
+		t.Errorf("got vwap %v, want 125", got)
+	}
+
+	// with no volume reported anywhere, every price counts the same
+	quotes[0].Volume, quotes[1].Volume = 0, 0
+	if got := vwap(quotes); got != 150 {
+		t.Errorf("got vwap %v without volume, want the mean of 150", got)
+	}
+}
+
+func TestComputeIndex(t *testing.T) {
+	snapshot := btcQuotes(map[string]Quote{
+		"Binance":  NewQuote(100, 1),
+		"Coinbase": NewQuote(101, 1),
+		"Kraken":   NewQuote(102, 1),
+		"Bitfinex": NewQuote(105, 1),
+	})
+	for _, test := range []struct {
+		index string
+		want  float64
+	}{
+		{"", 101.5},
+		{"index:\n  method: trimmed\n", 101.5},
+		{"index:\n  method: trimmed\n  trim: 0\n", 102},
+		{"index:\n  method: vwap\n", 102},
+	} {
+		testConfig(t, "assets: [BTC]\nquotes: [USD]\nexchanges: [binance, coinbase, kraken, bitfinex]\n"+test.index)
+		index, ok := computeIndex(snapshot, btcUSD)
+		if !ok || index.Price != test.want || len(index.Exchanges) != 4 {
+			t.Errorf("config %q: got index %+v, want %v", test.index, index, test.want)
+		}
+	}
+}
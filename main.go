@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	flags "github.com/jessevdk/go-flags"
 )
 
 var opts struct {
-	Port     int  `short:"p" description:"The port on which the server runs on" default:"8081"`
-	Insecure bool `short:"i" description:"Start the API using http. Not recommended"`
+	Port     int           `short:"p" description:"The port on which the server runs on" default:"8081"`
+	Insecure bool          `short:"i" description:"Start the API using http. Not recommended"`
+	Config   string        `short:"c" long:"config" description:"Path to the config file" default:"config.yaml"`
+	Backfill bool          `long:"backfill" description:"Backfill candles from the exchanges into the history store and exit"`
+	Since    time.Duration `long:"since" description:"How far back to backfill candles from" default:"720h"`
 }
 
 func main() {
@@ -18,6 +25,72 @@ func main() {
 		log.Fatal(err)
 	}
 
+	err = loadConfig(opts.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// everything started below stops once we're interrupted, so the history is closed cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if opts.Backfill {
+		if config.History.Path == "" {
+			log.Fatal("backfilling needs a history path in the config")
+		}
+		history, err = OpenHistory(config.History.Path, config.History.Retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// log.Fatal would skip closing the history, so the candles written so far might not be synced
+		err = backfill(ctx, history, opts.Since)
+		closeErr := history.Close()
+		if closeErr != nil {
+			log.Println("could not close history", closeErr)
+		}
+		if err != nil {
+			log.Println(err)
+			stop()
+			os.Exit(1)
+		}
+		log.Println("backfill complete")
+		return
+	}
+
+	var streaming []Exchange
+	if config.Stream {
+		streaming = startStreams(ctx)
+	}
+	startPoller(ctx, config.interval(), streaming)
+
+	var recorded <-chan struct{}
+	if config.History.Path != "" {
+		history, err = OpenHistory(config.History.Path, config.History.Retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		recorded = startRecorder(ctx, history, config.interval())
+	}
+
+	if len(config.Alerts.Rules) != 0 {
+		alerts = NewAlertEngine(config.Alerts.Rules, config.Alerts.Cooldown, notifiers())
+		startAlerts(ctx, alerts)
+	}
+
 	log.Println("starting server")
-	startServer(opts.Port, opts.Insecure)
+	err = startServer(ctx, opts.Port, opts.Insecure)
+	if err != nil {
+		log.Println(err)
+	}
+	stop()
+
+	if history != nil {
+		<-recorded
+		err = history.Close()
+		if err != nil {
+			log.Println("could not close history", err)
+		}
+	}
+	log.Println("shut down")
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// fetchesTotal counts polled fetches and streamed updates by exchange and result
+	fetchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "demodash_fetches_total",
+		Help: "Quotes fetched from each exchange, by result.",
+	}, []string{"exchange", "result"})
+
+	// requestDuration tracks how long requests to the exchanges' REST APIs take
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "demodash_upstream_request_duration_seconds",
+		Help:    "Latency of requests to each exchange's REST API.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"exchange"})
+)
+
+var (
+	priceDesc = prometheus.NewDesc("demodash_price", "Latest price of a pair on an exchange.",
+		[]string{"exchange", "asset", "quote"}, nil)
+	volumeDesc = prometheus.NewDesc("demodash_volume", "Latest 24 hour volume of a pair on an exchange.",
+		[]string{"exchange", "asset", "quote"}, nil)
+	ageDesc = prometheus.NewDesc("demodash_quote_age_seconds", "Time since a pair's quote on an exchange was fetched.",
+		[]string{"exchange", "asset", "quote"}, nil)
+	statusDesc = prometheus.NewDesc("demodash_quote_status", "Set to 1 for the current status of a pair's quote on an exchange.",
+		[]string{"exchange", "asset", "quote", "status"}, nil)
+	indexDesc = prometheus.NewDesc("demodash_index_price", "Index price of a pair across exchanges.",
+		[]string{"asset", "quote", "method"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(fetchesTotal, requestDuration, quoteCollector{})
+}
+
+// quoteCollector exports the quotes in the latest snapshot each time metrics are scraped
+type quoteCollector struct{}
+
+// Describe sends the descriptions of the quote metrics
+func (quoteCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- priceDesc
+	ch <- volumeDesc
+	ch <- ageDesc
+	ch <- statusDesc
+	ch <- indexDesc
+}
+
+// Collect sends the quote metrics for every listed pair on each exchange
+func (quoteCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshot := store.Snapshot()
+	now := time.Now()
+	for _, pair := range config.Pairs() {
+		for _, exchange := range exchanges {
+			if !listed(exchange, pair.Base) {
+				continue
+			}
+
+			quote := lookupQuote(snapshot, exchange, pair)
+			ch <- prometheus.MustNewConstMetric(statusDesc, prometheus.GaugeValue, 1,
+				exchange.Name(), pair.Base, pair.Quote, string(quote.Status))
+			if !quote.Available() {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(priceDesc, prometheus.GaugeValue, quote.Price,
+				exchange.Name(), pair.Base, pair.Quote)
+			ch <- prometheus.MustNewConstMetric(volumeDesc, prometheus.GaugeValue, quote.Volume,
+				exchange.Name(), pair.Base, pair.Quote)
+			ch <- prometheus.MustNewConstMetric(ageDesc, prometheus.GaugeValue, now.Sub(quote.Time).Seconds(),
+				exchange.Name(), pair.Base, pair.Quote)
+		}
+
+		if index, ok := computeIndex(snapshot, pair); ok {
+			ch <- prometheus.MustNewConstMetric(indexDesc, prometheus.GaugeValue, index.Price,
+				pair.Base, pair.Quote, index.Method)
+		}
+	}
+}
+
+// countFetch records the result of fetching a quote from an exchange
+func countFetch(exchange string, failed bool) {
+	result := "success"
+	if failed {
+		result = "failure"
+	}
+	fetchesTotal.WithLabelValues(exchange, result).Inc()
+}
+
+// serveMetrics serves metrics in the Prometheus format on /metrics
+func serveMetrics() {
+	http.Handle("/metrics", promhttp.Handler())
+}
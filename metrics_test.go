@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestQuoteMetrics(t *testing.T) {
+	testConfig(t, baseConfig)
+	store = NewStore()
+	snapshot := NewSnapshot(time.Now())
+	snapshot.set("Kraken", btcUSD, NewQuote(100, 1))
+	snapshot.set("Binance", btcUSD, ErrorQuote(errors.New("unavailable")))
+	store.Publish(snapshot)
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		`demodash_quote_status{asset="BTC",exchange="Kraken",quote="USD",status="ok"} 1`,
+		`demodash_quote_status{asset="BTC",exchange="Binance",quote="USD",status="error"} 1`,
+		`demodash_price{asset="BTC",exchange="Kraken",quote="USD"} 100`,
+		`demodash_index_price{asset="BTC",method="median",quote="USD"} 100`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics are missing %s", line)
+		}
+	}
+	// there's no status for pairs an exchange doesn't list, and no price for quotes that failed
+	for _, prefix := range []string{
+		`demodash_quote_status{asset="ADA",exchange="Coinbase"`,
+		`demodash_price{asset="BTC",exchange="Binance"`,
+	} {
+		if strings.Contains(body, prefix) {
+			t.Errorf("metrics have an unexpected %s}", prefix)
+		}
+	}
+}
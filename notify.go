@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// notifyBackoff is how long we wait before retrying a failed notification. It doubles after each attempt
+var notifyBackoff = time.Second
+
+// NotifyConfig is the notify section of the config file, which sets where alerts are sent
+type NotifyConfig struct {
+	// Retries is how many times a failed notification is retried. Defaults to 3 if it isn't set,
+	// while 0 turns retrying off
+	Retries *int `yaml:"retries"`
+	// Webhooks are the URLs alerts are posted to
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	// Email sends alerts through an SMTP server if a host is set
+	Email EmailConfig `yaml:"email"`
+}
+
+// defaultRetries is how many times a failed notification is retried if the config doesn't say
+var defaultRetries = 3
+
+// retries returns how many times a failed notification is retried
+func (c Config) retries() int {
+	if c.Notify.Retries == nil {
+		return defaultRetries
+	}
+	return *c.Notify.Retries
+}
+
+// notifiers returns the notifiers set up in the config
+func notifiers() []Notifier {
+	var list []Notifier
+	for _, webhook := range config.Notify.Webhooks {
+		list = append(list, NewWebhookNotifier(webhook))
+	}
+	if config.Notify.Email.Host != "" {
+		list = append(list, NewEmailNotifier(config.Notify.Email))
+	}
+	return list
+}
+
+// retry calls send until it succeeds, giving up after the configured number of retries or when
+// ctx is done. Errors that retrying won't fix can be wrapped with permanent to give up straight away
+func retry(ctx context.Context, name string, send func() error) error {
+	wait := notifyBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = send()
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(permanentError); ok || attempt >= config.retries() {
+			return err
+		}
+
+		log.Println("could not notify", name+", retrying in", wait, err)
+		if sleep(ctx, wait) != nil {
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// permanentError is an error that retrying won't fix
+type permanentError struct {
+	error
+}
+
+// permanent marks an error as one that retrying won't fix
+func permanent(err error) error {
+	return permanentError{err}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testNotifier records the alerts it's sent, failing every attempt if fail is set
+type testNotifier struct {
+	name string
+	fail bool
+	sent chan Alert
+}
+
+func (n *testNotifier) Name() string {
+	return n.name
+}
+
+func (n *testNotifier) Notify(ctx context.Context, alert Alert) error {
+	return retry(ctx, n.name, func() error {
+		if n.fail {
+			return errors.New("unavailable")
+		}
+		n.sent <- alert
+		return nil
+	})
+}
+
+func TestDeliverIsolatesNotifiers(t *testing.T) {
+	testConfig(t, baseConfig+"notify:\n  retries: 3\n")
+	backoff := notifyBackoff
+	notifyBackoff = time.Hour
+
+	failing := &testNotifier{name: "failing", fail: true}
+	working := &testNotifier{name: "working", sent: make(chan Alert, 2)}
+	engine := NewAlertEngine(nil, 0, []Notifier{failing, working})
+	ctx, cancel := context.WithCancel(context.Background())
+	delivered := make(chan struct{})
+	go func() {
+		engine.deliver(ctx)
+		close(delivered)
+	}()
+	defer func() {
+		// the notifiers have to stop before the backoff can be put back
+		cancel()
+		<-delivered
+		notifyBackoff = backoff
+	}()
+
+	// the failing notifier is stuck waiting to retry the first alert, which mustn't hold up the other
+	engine.send(Alert{Rule: "first", State: AlertFiring})
+	engine.send(Alert{Rule: "second", State: AlertFiring})
+	for _, want := range []string{"first", "second"} {
+		select {
+		case alert := <-working.sent:
+			if alert.Rule != want {
+				t.Errorf("got alert %s, want %s", alert.Rule, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("working notifier was held up by the failing one")
+		}
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	testConfig(t, baseConfig+"notify:\n  retries: 3\n")
+	defer func(backoff time.Duration) { notifyBackoff = backoff }(notifyBackoff)
+	notifyBackoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- retry(ctx, "test", func() error { return errors.New("unavailable") })
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("retry succeeded after being cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retry kept waiting after ctx was cancelled")
+	}
+}
+
+func TestRetryCount(t *testing.T) {
+	defer func(backoff time.Duration) { notifyBackoff = backoff }(notifyBackoff)
+	notifyBackoff = time.Millisecond
+
+	for _, test := range []struct {
+		notify   string
+		attempts int
+	}{
+		{"", 4},
+		{"notify:\n  retries: 1\n", 2},
+		{"notify:\n  retries: 0\n", 1},
+	} {
+		testConfig(t, baseConfig+test.notify)
+		attempts := 0
+		err := retry(context.Background(), "test", func() error {
+			attempts++
+			return errors.New("unavailable")
+		})
+		if err == nil || attempts != test.attempts {
+			t.Errorf("config %q: got %d attempts, want %d", test.notify, attempts, test.attempts)
+		}
+	}
+}
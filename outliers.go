@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// outliers checks each quote against the median price of all of them, returning the reason
+// each quote that deviates too far is suspect, keyed by exchange. At least three quotes are
+// needed, since with two there's no telling which of them is wrong
+func outliers(quotes []venueQuote) map[string]string {
+	suspect := make(map[string]string)
+	if len(quotes) < 3 {
+		return suspect
+	}
+
+	mid := median(prices(quotes))
+	for i, quote := range quotes {
+		diff := math.Abs(quote.Price - mid)
+		if config.Outliers.Percent > 0 && diff > mid*config.Outliers.Percent/100 {
+			suspect[quote.Exchange] = fmt.Sprintf("%.2f%% from the median price of %g", 100*diff/mid, mid)
+			continue
+		}
+
+		if config.Outliers.Deviations > 0 {
+			others := make([]venueQuote, 0, len(quotes)-1)
+			others = append(others, quotes[:i]...)
+			others = append(others, quotes[i+1:]...)
+			sd := stddev(prices(others))
+			if sd > 0 && diff > config.Outliers.Deviations*sd {
+				suspect[quote.Exchange] = fmt.Sprintf("%.1f standard deviations from the median price of %g", diff/sd, mid)
+			}
+		}
+	}
+	return suspect
+}
+
+// stddev returns the population standard deviation of a list of prices
+func stddev(list []float64) float64 {
+	var mean float64
+	for _, x := range list {
+		mean += x
+	}
+	mean /= float64(len(list))
+
+	var sum float64
+	for _, x := range list {
+		sum += (x - mean) * (x - mean)
+	}
+	return math.Sqrt(sum / float64(len(list)))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+// venueQuotes returns quotes for the passed prices on made up exchanges named A, B, C...
+func venueQuotes(prices ...float64) []venueQuote {
+	quotes := make([]venueQuote, len(prices))
+	for i, price := range prices {
+		quotes[i] = venueQuote{Exchange: string(rune('A' + i)), Quote: NewQuote(price, 1)}
+	}
+	return quotes
+}
+
+func TestOutliers(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		limits  string
+		prices  []float64
+		suspect []string
+	}{
+		{"within the percent limit", "percent: 5", []float64{100, 101, 104.9}, nil},
+		{"past the percent limit", "percent: 5", []float64{100, 101, 107}, []string{"C"}},
+		{"below the median", "percent: 5", []float64{90, 100, 101}, []string{"A"}},
+		{"two quotes can't tell which is wrong", "percent: 5", []float64{100, 200}, nil},
+		// 102 is 1.5 from the median of 100.5, over three times the 0.47 deviation of the others
+		{"past the deviation limit", "deviations: 2", []float64{100, 101, 100, 102}, []string{"D"}},
+		{"within the deviation limit", "deviations: 4", []float64{100, 101, 100, 102}, nil},
+		// the deviation check needs the other quotes to disagree at least a little
+		{"others agree exactly", "deviations: 2", []float64{100, 100, 100, 130}, nil},
+		{"no limits", "percent: 0\n  deviations: 0", []float64{100, 101, 500}, nil},
+	} {
+		testConfig(t, "assets: [BTC]\nquotes: [USD]\nexchanges: [kraken]\noutliers:\n  "+test.limits+"\n")
+		suspect := outliers(venueQuotes(test.prices...))
+		if len(suspect) != len(test.suspect) {
+			t.Errorf("%s: got suspect %v, want %v", test.name, suspect, test.suspect)
+			continue
+		}
+		for _, exchange := range test.suspect {
+			if suspect[exchange] == "" {
+				t.Errorf("%s: got suspect %v, want %v", test.name, suspect, test.suspect)
+			}
+		}
+	}
+}
+
+func TestSuspectQuotesLeftOut(t *testing.T) {
+	testConfig(t, "assets: [BTC]\nquotes: [USD]\nexchanges: [binance, coinbase, kraken, bitfinex]\noutliers:\n  percent: 5\n")
+	snapshot := btcQuotes(map[string]Quote{
+		"Binance":  NewQuote(100, 1),
+		"Coinbase": NewQuote(101, 1),
+		"Kraken":   NewQuote(102, 1),
+		"Bitfinex": NewQuote(1000, 1),
+	})
+
+	index, ok := computeIndex(snapshot, btcUSD)
+	if !ok || index.Price != 101 || contains(index.Exchanges, "Bitfinex") {
+		t.Errorf("got index %+v, want the median without Bitfinex", index)
+	}
+	spread, ok := computeSpread(snapshot, btcUSD)
+	if !ok || spread.High != "Kraken" {
+		t.Errorf("got spread %+v, want Bitfinex left out", spread)
+	}
+	// the suspect quote is still shown, just not used
+	if quote := lookupQuote(snapshot, Bitfinex{}, btcUSD); quote.Price != 1000 {
+		t.Errorf("got Bitfinex quote %+v", quote)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	errors "github.com/pkg/errors"
+)
+
+// defaultInterval is how often the poller refreshes the store if no interval is set in the config
+var defaultInterval = 30 * time.Second
+
+// startPoller refreshes the store in the background every interval until ctx is done. The passed
+// exchanges are only polled once at startup, since they're kept up to date by their streams
+func startPoller(ctx context.Context, interval time.Duration, streaming []Exchange) {
+	var polled []Exchange
+	for _, exchange := range exchanges {
+		if !containsExchange(streaming, exchange) {
+			polled = append(polled, exchange)
+		}
+	}
+
+	log.Println("refreshing tickers every", interval)
+	go func() {
+		poll(ctx, interval, exchanges)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				poll(ctx, interval, polled)
+			}
+		}
+	}()
+}
+
+// result is the outcome of fetching every configured pair from an exchange
+type result struct {
+	exchange Exchange
+	pairs    []Pair
+	quotes   []Quote
+}
+
+// poll fetches every configured pair from each of the passed exchanges and publishes the results
+// to the store as a new snapshot. Each fetch writes to its own result, so the goroutines share no
+// state. Fetches still running after timeout are cancelled, so a hanging exchange can't hold up the
+// others past the next poll. Nothing is published if ctx is done before the fetches finish
+func poll(ctx context.Context, timeout time.Duration, exchanges []Exchange) {
+	if len(exchanges) == 0 {
+		return
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var results []result
+	for _, exchange := range exchanges {
+		var pairs []Pair
+		for _, pair := range config.Pairs() {
+			if listed(exchange, pair.Base) {
+				pairs = append(pairs, pair)
+			}
+		}
+		if len(pairs) == 0 {
+			continue
+		}
+		results = append(results, result{exchange: exchange, pairs: pairs})
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(wg *sync.WaitGroup, res *result) {
+			defer wg.Done()
+			res.quotes = fetch(fetchCtx, res.exchange, res.pairs)
+		}(&wg, &results[i])
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	snapshot := NewSnapshot(time.Now())
+	for _, res := range results {
+		for i, pair := range res.pairs {
+			snapshot.set(res.exchange.Name(), pair, res.quotes[i])
+		}
+	}
+	store.Publish(snapshot)
+}
+
+// fetch gets the latest data for pairs from an exchange, returning a quote for each pair in order.
+// If the exchange's circuit breaker is open, the last quotes fetched from it are returned instead
+func fetch(ctx context.Context, exchange Exchange, pairs []Pair) []Quote {
+	breaker, ok := lookupBreaker(exchange.Name())
+	if !ok {
+		quotes, _ := fetchQuotes(ctx, exchange, pairs)
+		return quotes
+	}
+
+	if !breaker.Allow(time.Now()) {
+		return cachedQuotes(breaker, pairs)
+	}
+
+	quotes, err := fetchQuotes(ctx, exchange, pairs)
+	breaker.Record(err, time.Now())
+	if err != nil && breaker.Status().State == BreakerOpen {
+		// the failure opened the breaker, so serve the last quotes from here on
+		return cachedQuotes(breaker, pairs)
+	}
+	for i, pair := range pairs {
+		if quotes[i].Status == StatusOK {
+			breaker.remember(pair, quotes[i])
+		}
+	}
+	return quotes
+}
+
+// cachedQuotes returns the last quotes fetched for pairs through a breaker, marked stale
+func cachedQuotes(breaker *Breaker, pairs []Pair) []Quote {
+	quotes := make([]Quote, len(pairs))
+	for i, pair := range pairs {
+		quotes[i] = breaker.cached(pair)
+	}
+	return quotes
+}
+
+// fetchQuotes fetches pairs from an exchange, using a single request for exchanges with a batch
+// endpoint. The error is set if the exchange couldn't be reached, rather than for pairs that are
+// missing from its response
+func fetchQuotes(ctx context.Context, exchange Exchange, pairs []Pair) ([]Quote, error) {
+	batch, ok := exchange.(BatchExchange)
+	if !ok {
+		return fetchEach(ctx, exchange, pairs)
+	}
+
+	fetched, err := batch.Tickers(ctx, pairs)
+	if err != nil && rejected(err) && len(pairs) > 1 {
+		// a single pair the exchange doesn't know gets the whole batch rejected, so fall back to
+		// fetching them one at a time to get the rest
+		log.Println(exchange.Name(), "rejected a batch of", len(pairs), "pairs, fetching them separately:", err)
+		return fetchEach(ctx, exchange, pairs)
+	}
+	if err != nil {
+		log.Println("could not fetch", len(pairs), "pairs from", exchange.Name(), err)
+	}
+	quotes := make([]Quote, len(pairs))
+	for i, pair := range pairs {
+		quote, found := fetched[pair]
+		switch {
+		case err != nil:
+			quotes[i] = ErrorQuote(err)
+		case !found:
+			quotes[i] = ErrorQuote(errors.New("pair not found in " + exchange.Name() + " response"))
+		default:
+			quotes[i] = quote
+		}
+		countFetch(exchange.Name(), quotes[i].Status != StatusOK)
+	}
+	return quotes, err
+}
+
+// fetchEach fetches pairs from an exchange concurrently with a request per pair. The exchange is
+// only considered down if every pair failed, so its breaker sees a single outcome for the lot
+func fetchEach(ctx context.Context, exchange Exchange, pairs []Pair) ([]Quote, error) {
+	quotes := make([]Quote, len(pairs))
+	errs := make([]error, len(pairs))
+	var wg sync.WaitGroup
+	for i := range pairs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			quotes[i], errs[i] = fetchOne(ctx, exchange, pairs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return quotes, nil
+		}
+	}
+	return quotes, errs[0]
+}
+
+// fetchOne gets the latest data for a single pair from an exchange
+func fetchOne(ctx context.Context, exchange Exchange, pair Pair) (Quote, error) {
+	price, volume, err := exchange.Ticker(ctx, pair)
+	countFetch(exchange.Name(), err != nil)
+	if err != nil {
+		log.Println("could not fetch", pair, "from", exchange.Name(), err)
+		return ErrorQuote(err), err
+	}
+	return NewQuote(price, volume), nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchStandIn is an exchange's batch ticker endpoint that rejects the whole request if it's asked
+// for a symbol it doesn't know, like binance and kraken do
+type batchStandIn struct {
+	sync.Mutex
+	requests [][]string
+	// symbols parses the requested symbols out of a request
+	symbols func(req *http.Request) []string
+	// reject answers a request with an unknown symbol
+	reject func(w http.ResponseWriter)
+	// respond answers a request for known symbols
+	respond func(w http.ResponseWriter, symbols []string)
+	known   map[string]bool
+}
+
+func (s *batchStandIn) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	symbols := s.symbols(req)
+	s.Lock()
+	s.requests = append(s.requests, symbols)
+	s.Unlock()
+	for _, symbol := range symbols {
+		if !s.known[symbol] {
+			s.reject(w)
+			return
+		}
+	}
+	s.respond(w, symbols)
+}
+
+func TestBatchRejectedFallsBack(t *testing.T) {
+	testConfig(t, baseConfig)
+	defer func(binance string, kraken string) { BinanceReq, KrakenReq = binance, kraken }(BinanceReq, KrakenReq)
+	fooUSD := Pair{Base: "FOO", Quote: "USD"}
+
+	for _, test := range []struct {
+		exchange Exchange
+		url      *string
+		standIn  *batchStandIn
+	}{
+		{Binance{}, &BinanceReq, &batchStandIn{
+			known: map[string]bool{"BTCUSDT": true, "ETHUSDT": true},
+			symbols: func(req *http.Request) []string {
+				var symbols []string
+				json.Unmarshal([]byte(req.URL.Query().Get("symbols")), &symbols)
+				return symbols
+			},
+			reject: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"code":-1121,"msg":"Invalid symbol."}`)
+			},
+			respond: func(w http.ResponseWriter, symbols []string) {
+				var tickers []BinanceTickerResponse
+				for _, symbol := range symbols {
+					tickers = append(tickers, BinanceTickerResponse{Symbol: symbol, LastPrice: "100.5", Volume: "10"})
+				}
+				json.NewEncoder(w).Encode(tickers)
+			},
+		}},
+		{Kraken{}, &KrakenReq, &batchStandIn{
+			known: map[string]bool{"XBTUSD": true, "ETHUSD": true},
+			symbols: func(req *http.Request) []string {
+				return strings.Split(req.URL.Query().Get("pair"), ",")
+			},
+			reject: func(w http.ResponseWriter) {
+				fmt.Fprint(w, `{"error":["EQuery:Unknown asset pair"]}`)
+			},
+			respond: func(w http.ResponseWriter, symbols []string) {
+				names := map[string]string{"XBTUSD": "XXBTZUSD", "ETHUSD": "XETHZUSD"}
+				result := make(map[string]interface{})
+				for _, symbol := range symbols {
+					result[names[symbol]] = map[string][]string{"c": {"100.5", "1"}, "v": {"5", "10"}}
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": result})
+			},
+		}},
+	} {
+		server := httptest.NewServer(test.standIn)
+		defer server.Close()
+		query := strings.SplitN(*test.url, "?", 2)[1]
+		*test.url = server.URL + "/?" + query
+
+		quotes, err := fetchQuotes(context.Background(), test.exchange, []Pair{btcUSD, fooUSD, ethUSD})
+		if err != nil {
+			t.Errorf("%s: got error %v when only one pair is unknown", test.exchange.Name(), err)
+		}
+		for i, pair := range []Pair{btcUSD, ethUSD} {
+			quote := quotes[i*2]
+			if quote.Status != StatusOK || quote.Price != 100.5 || quote.Volume != 10 {
+				t.Errorf("%s: got %s quote %+v", test.exchange.Name(), pair, quote)
+			}
+		}
+		if quotes[1].Status == StatusOK {
+			t.Errorf("%s: got quote %+v for a pair it doesn't list", test.exchange.Name(), quotes[1])
+		}
+		// the rejected batch and then a request per pair
+		if len(test.standIn.requests) != 4 {
+			t.Errorf("%s: got requests %v", test.exchange.Name(), test.standIn.requests)
+		}
+	}
+}
+
+func TestPollRecordsOncePerExchange(t *testing.T) {
+	testConfig(t, `
+assets: [BTC, ETH, XRP, LTC, LINK]
+quotes: [USD]
+exchanges: [coinbase]
+breaker:
+  failures: 3
+`)
+	defer func(url string) { CoinbaseReq = url }(CoinbaseReq)
+	var lock sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	CoinbaseReq = server.URL + "/products/%s/ticker"
+	store = NewStore()
+
+	// coinbase is fetched a pair at a time, but a poll where all five fail is still one failure
+	poll(context.Background(), time.Second, exchanges)
+	if requests != 5 {
+		t.Errorf("got %d requests, want one per pair", requests)
+	}
+	status := breakerStatus("Coinbase")
+	if status.State != BreakerClosed || status.Failures != 1 {
+		t.Errorf("got breaker %+v after a single failed poll", status)
+	}
+
+	poll(context.Background(), time.Second, exchanges)
+	poll(context.Background(), time.Second, exchanges)
+	if status := breakerStatus("Coinbase"); status.State != BreakerOpen || status.Failures != 3 {
+		t.Errorf("got breaker %+v after three failed polls", status)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+)
+
+// Status describes whether a quote can be used
+type Status string
+
+const (
+	// StatusOK is set on quotes that were fetched successfully
+	StatusOK Status = "ok"
+	// StatusError is set on quotes that could not be fetched
+	StatusError Status = "error"
+	// StatusUnsupported is set on quotes for pairs that aren't listed on the exchange
+	StatusUnsupported Status = "unsupported"
+	// StatusStale is set on quotes that haven't been refreshed recently
+	StatusStale Status = "stale"
+	// StatusSuspect is set on quotes that deviate too far from the other exchanges' prices
+	StatusSuspect Status = "suspect"
+)
+
+// Quote is the price and volume of a pair on a single exchange
+type Quote struct {
+	Price  float64   `json:"price"`
+	Volume float64   `json:"volume"`
+	Status Status    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// NewQuote returns a quote for a successful fetch
+func NewQuote(price float64, volume float64) Quote {
+	return Quote{Price: price, Volume: volume, Status: StatusOK, Time: time.Now()}
+}
+
+// ErrorQuote returns a quote for a failed fetch
+func ErrorQuote(err error) Quote {
+	return Quote{Status: StatusError, Error: err.Error(), Time: time.Now()}
+}
+
+// UnsupportedQuote returns a quote for a pair that isn't listed on an exchange
+func UnsupportedQuote() Quote {
+	return Quote{Status: StatusUnsupported, Error: "pair not listed on exchange"}
+}
+
+// Available checks whether the quote has a price that can be displayed
+func (q Quote) Available() bool {
+	return q.Status == StatusOK || q.Status == StatusStale || q.Status == StatusSuspect
+}
+
+// checkStale marks a successful quote as stale if it was fetched more than maxAge ago
+func (q Quote) checkStale(now time.Time, maxAge time.Duration) Quote {
+	if q.Status == StatusOK && now.Sub(q.Time) > maxAge {
+		q.Status = StatusStale
+	}
+	return q
+}
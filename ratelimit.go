@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LimitConfig is an exchange's request budget: Requests requests every Per, with bursts of up to Burst requests
+type LimitConfig struct {
+	Requests float64       `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	// Burst defaults to Requests
+	Burst float64 `yaml:"burst"`
+}
+
+// defaultLimits are based on each exchange's published limits for public endpoints, and are used
+// for exchanges that aren't in the limits section of the config. Binance counts request weight
+// rather than requests, and the endpoints we use weigh up to 2, so it gets half its 1200 weight
+// per minute
+var defaultLimits = map[string]LimitConfig{
+	"binance":  {Requests: 600, Per: time.Minute, Burst: 50},
+	"coinbase": {Requests: 10, Per: time.Second, Burst: 15},
+	"kraken":   {Requests: 1, Per: time.Second, Burst: 5},
+	"bitfinex": {Requests: 30, Per: time.Minute, Burst: 10},
+}
+
+// TokenBucket is a rate limiter that refills at a steady rate up to a maximum number of tokens.
+// Each request takes a token, and requests that find the bucket empty wait for their turn
+type TokenBucket struct {
+	sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	// waits counts the requests that had to wait for a token
+	waits int64
+}
+
+// NewTokenBucket returns a full bucket for the passed limit
+func NewTokenBucket(limit LimitConfig) *TokenBucket {
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = limit.Requests
+	}
+	return &TokenBucket{
+		rate:   limit.Requests / limit.Per.Seconds(),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens earned since the last refill. It must be called with the lock held
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// reserve takes a token and returns how long to wait before it can be used. Tokens are taken
+// even if the bucket is empty, so requests that are waiting are served in the order they arrived
+func (b *TokenBucket) reserve(now time.Time) time.Duration {
+	b.Lock()
+	defer b.Unlock()
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	b.waits++
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// release gives back a reserved token that won't be used
+func (b *TokenBucket) release(now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	b.refill(now)
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// Wait blocks until a request can be made or ctx is done
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	wait := b.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	err := sleep(ctx, wait)
+	if err != nil {
+		// the request is given up on, so its token goes to the requests after it
+		b.release(time.Now())
+	}
+	return err
+}
+
+// Budget is the state of an exchange's rate limiter
+type Budget struct {
+	Exchange string `json:"exchange"`
+	// Rate is how many requests can be made per second, and Burst is how many can be made at once
+	Rate  float64 `json:"rate"`
+	Burst float64 `json:"burst"`
+	// Remaining is how many requests can be made right now. It's negative if requests are waiting
+	Remaining float64 `json:"remaining"`
+	Waits     int64   `json:"waits"`
+}
+
+// Budget returns the current state of the bucket
+func (b *TokenBucket) Budget() Budget {
+	b.Lock()
+	defer b.Unlock()
+	b.refill(time.Now())
+	return Budget{Rate: b.rate, Burst: b.burst, Remaining: b.tokens, Waits: b.waits}
+}
+
+// limiters holds the rate limiter for each exchange, keyed by lowercase name. It's set up
+// when the config is loaded and only read afterwards
+var limiters = make(map[string]*TokenBucket)
+
+// setupLimiters creates a rate limiter for every known exchange from the config, falling back
+// to the default limits
+func setupLimiters(limits map[string]LimitConfig) {
+	list := make(map[string]*TokenBucket)
+	for name := range registry {
+		limit, ok := limits[name]
+		if !ok {
+			limit, ok = defaultLimits[name]
+		}
+		if ok {
+			list[name] = NewTokenBucket(limit)
+		}
+	}
+	limiters = list
+}
+
+// waitForBudget blocks until a request can be made to an exchange or ctx is done
+func waitForBudget(ctx context.Context, exchange string) error {
+	if limiter, ok := limiters[strings.ToLower(exchange)]; ok {
+		return limiter.Wait(ctx)
+	}
+	return nil
+}
+
+// budgets returns the budget of every exchange the dashboard queries
+func budgets() []Budget {
+	var list []Budget
+	for _, exchange := range exchanges {
+		limiter, ok := limiters[strings.ToLower(exchange.Name())]
+		if !ok {
+			continue
+		}
+		budget := limiter.Budget()
+		budget.Exchange = exchange.Name()
+		list = append(list, budget)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Exchange < list[j].Exchange })
+	return list
+}
+
+var (
+	budgetDesc = prometheus.NewDesc("demodash_rate_limit_remaining", "Requests that can be made to an exchange right now.",
+		[]string{"exchange"}, nil)
+	waitsDesc = prometheus.NewDesc("demodash_rate_limit_waits_total", "Requests that had to wait for the rate limiter.",
+		[]string{"exchange"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(budgetCollector{})
+}
+
+// budgetCollector exports each exchange's rate limit budget when metrics are scraped
+type budgetCollector struct{}
+
+// Describe sends the descriptions of the budget metrics
+func (budgetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- budgetDesc
+	ch <- waitsDesc
+}
+
+// Collect sends the budget metrics for every exchange the dashboard queries
+func (budgetCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, budget := range budgets() {
+		ch <- prometheus.MustNewConstMetric(budgetDesc, prometheus.GaugeValue, budget.Remaining, budget.Exchange)
+		ch <- prometheus.MustNewConstMetric(waitsDesc, prometheus.CounterValue, float64(budget.Waits), budget.Exchange)
+	}
+}
+
+// LimitsResponse is the response to /api/v1/limits
+type LimitsResponse struct {
+	Limits []Budget `json:"limits"`
+}
+
+// getLimits serves /api/v1/limits, showing the remaining request budget of each exchange
+func getLimits() {
+	http.HandleFunc("/api/v1/limits", func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+		writeJSON(w, LimitsResponse{Limits: budgets()})
+	})
+}
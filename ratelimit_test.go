@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testBucket returns a full bucket for limit, last refilled at start
+func testBucket(limit LimitConfig, start time.Time) *TokenBucket {
+	b := NewTokenBucket(limit)
+	b.last = start
+	return b
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	start := time.Now()
+	b := testBucket(LimitConfig{Requests: 10, Per: time.Second, Burst: 3}, start)
+	for i := 0; i < 3; i++ {
+		if wait := b.reserve(start); wait != 0 {
+			t.Fatalf("request %d of the burst waited %v", i+1, wait)
+		}
+	}
+	// each request past the burst waits for another tenth of a second
+	for i := 1; i <= 2; i++ {
+		if wait := b.reserve(start); wait != time.Duration(i)*100*time.Millisecond {
+			t.Errorf("request %d past the burst waited %v", i, wait)
+		}
+	}
+	if b.waits != 2 {
+		t.Errorf("counted %d waits, want 2", b.waits)
+	}
+
+	if burst := NewTokenBucket(LimitConfig{Requests: 4, Per: time.Second}).burst; burst != 4 {
+		t.Errorf("got burst %v, want it to default to the requests", burst)
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	start := time.Now()
+	b := testBucket(LimitConfig{Requests: 10, Per: time.Second, Burst: 3}, start)
+	for i := 0; i < 3; i++ {
+		b.reserve(start)
+	}
+
+	// two tenths of a second earns two tokens
+	for i := 0; i < 2; i++ {
+		if wait := b.reserve(start.Add(200 * time.Millisecond)); wait != 0 {
+			t.Errorf("request %d after the refill waited %v", i+1, wait)
+		}
+	}
+	if wait := b.reserve(start.Add(200 * time.Millisecond)); wait <= 0 {
+		t.Error("request didn't wait once the refill was used up")
+	}
+
+	// refills stop at the burst
+	b.refill(start.Add(time.Hour))
+	if b.tokens != 3 {
+		t.Errorf("got %v tokens after an hour, want the burst of 3", b.tokens)
+	}
+}
+
+func TestTokenBucketCancelledWait(t *testing.T) {
+	b := NewTokenBucket(LimitConfig{Requests: 1, Per: time.Hour, Burst: 1})
+	err := b.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = b.Wait(ctx)
+	if err == nil {
+		t.Fatal("wait for an empty bucket returned before ctx was done")
+	}
+
+	// the cancelled wait gave its token back, so the next request only waits for one token
+	if remaining := b.Budget().Remaining; remaining < -0.01 || remaining > 0.01 {
+		t.Errorf("got %v tokens remaining, want the cancelled wait's token back", remaining)
+	}
+	if wait := b.reserve(time.Now()); wait > time.Hour {
+		t.Errorf("next request waits %v, want at most an hour", wait)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	errors "github.com/pkg/errors"
+)
+
+var (
+	// defaultTimeout is how long a single request to an exchange can take if no timeout is set in the config
+	defaultTimeout = 10 * time.Second
+	// fetchRetries is how many times a request that failed with a transient error is retried
+	fetchRetries = 2
+	// retryBackoff is the most we wait before the first retry. It doubles after each attempt,
+	// and the actual wait is picked at random up to it so retries from many fetches don't line up
+	retryBackoff = 500 * time.Millisecond
+	// maxRetryBackoff caps the wait between retries
+	maxRetryBackoff = 5 * time.Second
+)
+
+// httpClient is used for every request to the exchanges' REST APIs. Deadlines come from the
+// context passed with each request rather than the client
+var httpClient = &http.Client{}
+
+// statusError is returned for requests that got a response with an error status
+type statusError struct {
+	code int
+	body string
+}
+
+func (e statusError) Error() string {
+	return "got status " + strconv.Itoa(e.code) + ": " + e.body
+}
+
+// transient checks whether a failed request is worth retrying
+func transient(err error) bool {
+	if status, ok := errors.Cause(err).(statusError); ok {
+		return status.code >= 500 || status.code == http.StatusTooManyRequests
+	}
+	// anything else is a network error or a timeout of the single attempt
+	return true
+}
+
+// rejectedError is returned when an exchange answers a request with an error of its own, such as
+// for a pair it doesn't list
+type rejectedError string
+
+func (e rejectedError) Error() string {
+	return string(e)
+}
+
+// rejected checks whether an exchange turned a request down because of what was asked for, rather
+// than failing to serve it
+func rejected(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case rejectedError:
+		return true
+	case statusError:
+		return cause.code == http.StatusBadRequest
+	}
+	return false
+}
+
+// timeout returns how long a single request to an exchange can take
+func (c Config) timeout(exchange string) time.Duration {
+	if timeout, ok := c.Timeouts[strings.ToLower(exchange)]; ok {
+		return timeout
+	}
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return defaultTimeout
+}
+
+// getRequest makes a GET request to an exchange's REST API. Each attempt waits for the exchange's
+// rate limiter and is cut off after the exchange's timeout, and transient failures are retried
+// with a jittered exponential backoff until ctx is done
+func getRequest(ctx context.Context, exchange string, url string) ([]byte, error) {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		data, err := getOnce(ctx, exchange, url)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= fetchRetries || !transient(err) {
+			return nil, err
+		}
+
+		err = sleep(ctx, time.Duration(rand.Int63n(int64(backoff))))
+		if err != nil {
+			return nil, err
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// sleep waits for d, returning early with an error if ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// getOnce makes a single attempt at a request, recording how long it took
+func getOnce(ctx context.Context, exchange string, url string) ([]byte, error) {
+	err := waitForBudget(ctx, exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.timeout(exchange))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	defer func() {
+		requestDuration.WithLabelValues(exchange).Observe(time.Since(start).Seconds())
+	}()
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body := string(data)
+		if len(body) > 200 {
+			body = body[:200]
+		}
+		return nil, statusError{code: res.StatusCode, body: body}
+	}
+	return data, nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	erpc "github.com/Varunram/essentials/rpc"
+)
+
+// TickerResponse is the JSON representation of a pair's quotes on each exchange
+type TickerResponse struct {
+	Asset     string           `json:"asset"`
+	Quote     string           `json:"quote"`
+	Exchanges map[string]Quote `json:"exchanges"`
+	// Index is left out if no exchange has a fresh quote for the pair
+	Index *IndexPrice `json:"index,omitempty"`
+}
+
+// TickersResponse is the response to /api/v1/tickers and /api/v1/tickers/{asset}
+type TickersResponse struct {
+	Updated time.Time        `json:"updated"`
+	Tickers []TickerResponse `json:"tickers"`
+}
+
+// ExchangeTicker is the JSON representation of a pair's quote on a single exchange
+type ExchangeTicker struct {
+	Asset  string `json:"asset"`
+	Quote  string `json:"quote"`
+	Ticker Quote  `json:"ticker"`
+}
+
+// ExchangeResponse is the response to /api/v1/exchanges/{exchange}
+type ExchangeResponse struct {
+	Exchange string           `json:"exchange"`
+	Updated  time.Time        `json:"updated"`
+	Breaker  BreakerStatus    `json:"breaker"`
+	Tickers  []ExchangeTicker `json:"tickers"`
+}
+
+// writeJSON marshals x and writes it to the response
+func writeJSON(w http.ResponseWriter, x interface{}) {
+	data, err := json.Marshal(x)
+	if err != nil {
+		log.Println(err)
+		erpc.ResponseHandler(w, erpc.StatusInternalServerError, APIError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// checkGet makes sure the request is a GET request
+func checkGet(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		erpc.ResponseHandler(w, erpc.StatusBadRequest, "only GET requests are supported")
+		return false
+	}
+	return true
+}
+
+// tickers returns the quotes for every configured pair whose base asset is in assets, or every pair if assets is empty
+func tickers(snapshot *Snapshot, assets ...string) []TickerResponse {
+	var list []TickerResponse
+	for _, pair := range config.Pairs() {
+		if len(assets) != 0 && !contains(assets, pair.Base) {
+			continue
+		}
+
+		ticker := TickerResponse{Asset: pair.Base, Quote: pair.Quote, Exchanges: make(map[string]Quote)}
+		for _, exchange := range exchanges {
+			ticker.Exchanges[exchange.Name()] = lookupQuote(snapshot, exchange, pair)
+		}
+		if index, ok := computeIndex(snapshot, pair); ok {
+			ticker.Index = &index
+		}
+		list = append(list, ticker)
+	}
+	return list
+}
+
+// contains checks whether x is in list
+func contains(list []string, x string) bool {
+	for _, elem := range list {
+		if elem == x {
+			return true
+		}
+	}
+	return false
+}
+
+func setupAPI() {
+	getTickers()
+	getExchange()
+	getHistory()
+	getCandles()
+	getSpreads()
+	getAlerts()
+	getLimits()
+	getBreakers()
+}
+
+// getTickers serves /api/v1/tickers and /api/v1/tickers/{asset}
+func getTickers() {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+
+		snapshot := store.Snapshot()
+		asset := strings.ToUpper(strings.Trim(strings.TrimPrefix(req.URL.Path, "/api/v1/tickers"), "/"))
+		if asset == "" {
+			writeJSON(w, TickersResponse{Updated: snapshot.Time, Tickers: tickers(snapshot)})
+			return
+		}
+
+		if !contains(config.Assets, asset) {
+			erpc.ResponseHandler(w, erpc.StatusNotFound, "asset not found")
+			return
+		}
+		writeJSON(w, TickersResponse{Updated: snapshot.Time, Tickers: tickers(snapshot, asset)})
+	}
+
+	http.HandleFunc("/api/v1/tickers", handler)
+	http.HandleFunc("/api/v1/tickers/", handler)
+}
+
+// getExchange serves /api/v1/exchanges/{exchange}
+func getExchange() {
+	http.HandleFunc("/api/v1/exchanges/", func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+
+		name := strings.Trim(strings.TrimPrefix(req.URL.Path, "/api/v1/exchanges/"), "/")
+		exchange, ok := lookupExchange(name)
+		if !ok || !active(exchange) {
+			erpc.ResponseHandler(w, erpc.StatusNotFound, "exchange not found")
+			return
+		}
+
+		snapshot := store.Snapshot()
+		response := ExchangeResponse{Exchange: exchange.Name(), Updated: snapshot.Time, Breaker: breakerStatus(exchange.Name())}
+		for _, pair := range config.Pairs() {
+			response.Tickers = append(response.Tickers, ExchangeTicker{
+				Asset:  pair.Base,
+				Quote:  pair.Quote,
+				Ticker: lookupQuote(snapshot, exchange, pair),
+			})
+		}
+		writeJSON(w, response)
+	})
+}
+
+// HistoryResponse is the response to /api/v1/history
+type HistoryResponse struct {
+	Exchange string    `json:"exchange"`
+	Asset    string    `json:"asset"`
+	Quote    string    `json:"quote"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Quotes   []Quote   `json:"quotes"`
+}
+
+// parseTime parses an RFC3339 timestamp from the query, returning def if it isn't set
+func parseTime(req *http.Request, key string, def time.Time) (time.Time, error) {
+	value := req.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parsePair reads the asset and exchange from the query. The quote currency defaults to the first one in the config
+func parsePair(w http.ResponseWriter, req *http.Request) (Exchange, Pair, bool) {
+	query := req.URL.Query()
+	pair := Pair{Base: strings.ToUpper(query.Get("asset")), Quote: strings.ToUpper(query.Get("quote"))}
+	if pair.Quote == "" {
+		pair.Quote = config.Quotes[0]
+	}
+	if !contains(config.Assets, pair.Base) || !contains(config.Quotes, pair.Quote) {
+		erpc.ResponseHandler(w, erpc.StatusBadRequest, "unknown asset or quote currency")
+		return nil, pair, false
+	}
+
+	exchange, ok := lookupExchange(query.Get("exchange"))
+	if !ok || !active(exchange) {
+		erpc.ResponseHandler(w, erpc.StatusBadRequest, "unknown exchange")
+		return nil, pair, false
+	}
+	return exchange, pair, true
+}
+
+// getHistory serves /api/v1/history?asset=BTC&exchange=kraken&from=...&to=..., returning the
+// recorded quotes between from and to. The range defaults to the last hour
+func getHistory() {
+	http.HandleFunc("/api/v1/history", func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+		if history == nil {
+			erpc.ResponseHandler(w, erpc.StatusNotFound, "history is not enabled")
+			return
+		}
+
+		exchange, pair, ok := parsePair(w, req)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		from, err := parseTime(req, "from", now.Add(-time.Hour))
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest, "from is not an RFC3339 timestamp")
+			return
+		}
+		to, err := parseTime(req, "to", now)
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest, "to is not an RFC3339 timestamp")
+			return
+		}
+
+		quotes, err := history.Quotes(exchange.Name(), pair, from, to)
+		if err != nil {
+			log.Println(err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError, APIError)
+			return
+		}
+
+		writeJSON(w, HistoryResponse{
+			Exchange: exchange.Name(),
+			Asset:    pair.Base,
+			Quote:    pair.Quote,
+			From:     from,
+			To:       to,
+			Quotes:   quotes,
+		})
+	})
+}
+
+// CandlesResponse is the response to /api/v1/candles
+type CandlesResponse struct {
+	Exchange string   `json:"exchange"`
+	Asset    string   `json:"asset"`
+	Quote    string   `json:"quote"`
+	Interval string   `json:"interval"`
+	Candles  []Candle `json:"candles"`
+}
+
+// getCandles serves /api/v1/candles?asset=BTC&exchange=kraken&interval=1h&from=...&to=..., returning
+// the candles that open between from and to. The range defaults to the last hundred intervals
+func getCandles() {
+	http.HandleFunc("/api/v1/candles", func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+		if history == nil {
+			erpc.ResponseHandler(w, erpc.StatusNotFound, "history is not enabled")
+			return
+		}
+
+		exchange, pair, ok := parsePair(w, req)
+		if !ok {
+			return
+		}
+
+		name := req.URL.Query().Get("interval")
+		interval, ok := intervals[name]
+		if !ok {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest, "interval must be one of 1m, 5m, 1h or 1d")
+			return
+		}
+
+		now := time.Now()
+		from, err := parseTime(req, "from", now.Add(-100*interval))
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest, "from is not an RFC3339 timestamp")
+			return
+		}
+		to, err := parseTime(req, "to", now)
+		if err != nil {
+			erpc.ResponseHandler(w, erpc.StatusBadRequest, "to is not an RFC3339 timestamp")
+			return
+		}
+
+		candles, err := history.Candles(exchange.Name(), pair, name, from, to)
+		if err != nil {
+			log.Println(err)
+			erpc.ResponseHandler(w, erpc.StatusInternalServerError, APIError)
+			return
+		}
+
+		writeJSON(w, CandlesResponse{
+			Exchange: exchange.Name(),
+			Asset:    pair.Base,
+			Quote:    pair.Quote,
+			Interval: name,
+			Candles:  candles,
+		})
+	})
+}
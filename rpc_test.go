@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// apiOnce registers the API handlers, since handlers can only be registered once
+var apiOnce sync.Once
+
+// getAPI serves a request to the API, returning the recorded response
+func getAPI(t *testing.T, method string, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	apiOnce.Do(setupAPI)
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestTickersAPI(t *testing.T) {
+	testConfig(t, baseConfig)
+	store = NewStore()
+	snapshot := NewSnapshot(time.Now())
+	snapshot.set("Kraken", btcUSD, NewQuote(100, 1))
+	store.Publish(snapshot)
+
+	w := getAPI(t, http.MethodGet, "/api/v1/tickers/btc")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	var response TickersResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Tickers) != 1 || response.Tickers[0].Asset != "BTC" || response.Tickers[0].Exchanges["Kraken"].Price != 100 {
+		t.Errorf("got tickers %+v, want BTC/USD", response.Tickers)
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodGet, "/api/v1/tickers", http.StatusOK},
+		{http.MethodGet, "/api/v1/tickers/doge", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/tickers", http.StatusBadRequest},
+	} {
+		if w := getAPI(t, test.method, test.path); w.Code != test.code {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.path, w.Code, test.code)
+		}
+	}
+}
+
+func TestExchangeAPI(t *testing.T) {
+	testConfig(t, baseConfig)
+	store = NewStore()
+
+	w := getAPI(t, http.MethodGet, "/api/v1/exchanges/kraken")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	var response ExchangeResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Exchange != "Kraken" || response.Breaker.State != BreakerClosed || len(response.Tickers) != len(config.Pairs()) {
+		t.Errorf("got response %+v", response)
+	}
+
+	if w := getAPI(t, http.MethodGet, "/api/v1/exchanges/nope"); w.Code != http.StatusNotFound {
+		t.Errorf("got status %d for an unknown exchange", w.Code)
+	}
+	// binance is registered, but not used in this config
+	testConfig(t, "assets: [BTC]\nquotes: [USD]\nexchanges: [kraken]\n")
+	if w := getAPI(t, http.MethodGet, "/api/v1/exchanges/binance"); w.Code != http.StatusNotFound {
+		t.Errorf("got status %d for an exchange that isn't configured", w.Code)
+	}
+}
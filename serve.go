@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"html/template"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
-	"sync"
-	"text/template"
+	"time"
+
+	errors "github.com/pkg/errors"
 
 	erpc "github.com/Varunram/essentials/rpc"
 	utils "github.com/Varunram/essentials/utils"
@@ -17,6 +21,9 @@ var (
 
 	// RenderError is the error reutnred if something goes wrong while rendering the frontend
 	RenderError = "Error while rendering html, please try again"
+
+	// shutdownTimeout is how long in-flight requests get to finish when the server shuts down
+	shutdownTimeout = 10 * time.Second
 )
 
 func renderHTML() (string, error) {
@@ -24,27 +31,86 @@ func renderHTML() (string, error) {
 	return string(doc), err
 }
 
-type base struct {
-	BTCPrice   float64
-	ETHPrice   float64
-	XRPPrice   float64
-	LTCPrice   float64
-	LINKPrice  float64
-	ADAPrice   float64
-	BTCVolume  float64
-	ETHVolume  float64
-	XRPVolume  float64
-	LTCVolume  float64
-	LINKVolume float64
-	ADAVolume  float64
+// Row is a single pair's row on the dashboard
+type Row struct {
+	Pair   Pair
+	Quotes []Quote
+	// Index is nil if no exchange has a fresh quote for the pair
+	Index *IndexPrice
+	// Spread is nil if fewer than two exchanges have a fresh quote for the pair
+	Spread *Spread
+}
+
+// Dashboard is the structure used to feed data to the frontend. A new one is built for every
+// request, so concurrent page loads don't share any state
+type Dashboard struct {
+	// Exchanges are the state of each exchange's circuit breaker, in the order they're displayed
+	Exchanges []BreakerStatus
+	Rows      []Row
+	Updated   time.Time
 }
 
-// Return is the structure used to feed data to the frontend
-var Return struct {
-	Binance  base
-	Coinbase base
-	Kraken   base
-	Bitfinex base
+// buildDashboard lays out the data in a snapshot as rows of cells, one row per configured pair
+func buildDashboard(snapshot *Snapshot) Dashboard {
+	var dashboard Dashboard
+	dashboard.Updated = snapshot.Time
+	dashboard.Exchanges = make([]BreakerStatus, len(exchanges))
+	for i, exchange := range exchanges {
+		dashboard.Exchanges[i] = breakerStatus(exchange.Name())
+	}
+
+	pairs := config.Pairs()
+	dashboard.Rows = make([]Row, len(pairs))
+	for i, pair := range pairs {
+		dashboard.Rows[i] = Row{Pair: pair, Quotes: make([]Quote, len(exchanges))}
+		for j, exchange := range exchanges {
+			dashboard.Rows[i].Quotes[j] = lookupQuote(snapshot, exchange, pair)
+		}
+		if index, ok := computeIndex(snapshot, pair); ok {
+			dashboard.Rows[i].Index = &index
+		}
+		if spread, ok := computeSpread(snapshot, pair); ok {
+			dashboard.Rows[i].Spread = &spread
+		}
+	}
+	return dashboard
+}
+
+// lookupQuote returns the quote for a pair on an exchange from a snapshot, marking it stale if it's
+// too old or suspect if it's too far from the other exchanges' prices
+func lookupQuote(snapshot *Snapshot, exchange Exchange, pair Pair) Quote {
+	quote := currentQuote(snapshot, exchange, pair)
+	if quote.Status != StatusOK {
+		return quote
+	}
+
+	if reason, ok := outliers(okQuotes(snapshot, pair))[exchange.Name()]; ok {
+		quote.Status = StatusSuspect
+		quote.Error = reason
+	}
+	return quote
+}
+
+// checkUpdate replaces the quote in an update with the one from lookupQuote, so that subscribers
+// see it marked stale or suspect the same way the dashboard does
+func checkUpdate(snapshot *Snapshot, update Update) Update {
+	if exchange, ok := lookupExchange(update.Exchange); ok {
+		update.Ticker = lookupQuote(snapshot, exchange, update.Pair)
+	}
+	return update
+}
+
+// currentQuote returns the quote for a pair on an exchange from a snapshot, marking it stale if it's too old
+func currentQuote(snapshot *Snapshot, exchange Exchange, pair Pair) Quote {
+	if !listed(exchange, pair.Base) {
+		return UnsupportedQuote()
+	}
+
+	quote, ok := snapshot.Get(exchange.Name(), pair)
+	if !ok {
+		return Quote{Status: StatusError, Error: "waiting for first update"}
+	}
+	return quote.checkStale(time.Now(), config.staleAfter())
 }
 
 func frontend() {
@@ -53,290 +119,14 @@ func frontend() {
 		if err != nil {
 			log.Println(err)
 			erpc.ResponseHandler(w, erpc.StatusInternalServerError, APIError)
+			return
 		}
 		templates := template.New("template")
 		templates.New("doc").Parse(doc)
 
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.BTCPrice, err = BinanceTicker("BTC")
-			if err != nil {
-				Return.Binance.BTCPrice = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.ETHPrice, err = BinanceTicker("ETH")
-			if err != nil {
-				Return.Binance.ETHPrice = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.XRPPrice, err = BinanceTicker("XRP")
-			if err != nil {
-				Return.Binance.XRPPrice = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.LTCPrice, err = BinanceTicker("LTC")
-			if err != nil {
-				Return.Binance.LTCPrice = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.LINKPrice, err = BinanceTicker("LINK")
-			if err != nil {
-				Return.Binance.LINKPrice = -1
-			}
-		}(&wg)
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.ADAPrice, err = BinanceTicker("ADA")
-			if err != nil {
-				Return.Binance.ADAPrice = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.BTCVolume, err = BinanceVolume("BTC")
-			if err != nil {
-				Return.Binance.BTCVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.ETHVolume, err = BinanceVolume("ETH")
-			if err != nil {
-				Return.Binance.ETHVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.XRPVolume, err = BinanceVolume("XRP")
-			if err != nil {
-				Return.Binance.XRPVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.LTCVolume, err = BinanceVolume("LTC")
-			if err != nil {
-				Return.Binance.LTCVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.LINKVolume, err = BinanceVolume("LINK")
-			if err != nil {
-				Return.Binance.LINKVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Binance.ADAVolume, err = BinanceVolume("ADA")
-			if err != nil {
-				Return.Binance.ADAVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Coinbase.BTCPrice, Return.Coinbase.BTCVolume, err = CoinbaseTicker("BTC")
-			if err != nil {
-				Return.Coinbase.BTCPrice = -1
-				Return.Coinbase.BTCVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Coinbase.ETHPrice, Return.Coinbase.ETHVolume, err = CoinbaseTicker("ETH")
-			if err != nil {
-				Return.Coinbase.ETHPrice = -1
-				Return.Coinbase.ETHVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Coinbase.XRPPrice, Return.Coinbase.XRPVolume, err = CoinbaseTicker("XRP")
-			if err != nil {
-				Return.Coinbase.XRPPrice = -1
-				Return.Coinbase.XRPVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Coinbase.LTCPrice, Return.Coinbase.LTCVolume, err = CoinbaseTicker("LTC")
-			if err != nil {
-				Return.Coinbase.LTCPrice = -1
-				Return.Coinbase.LTCVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Coinbase.LINKPrice, Return.Coinbase.LINKVolume, err = CoinbaseTicker("LINK")
-			if err != nil {
-				Return.Coinbase.LINKPrice = -1
-				Return.Coinbase.LINKVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Kraken.BTCPrice, Return.Kraken.BTCVolume, err = KrakenTicker("BTC")
-			if err != nil {
-				Return.Kraken.BTCPrice = -1
-				Return.Kraken.BTCVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Kraken.ETHPrice, Return.Kraken.ETHVolume, err = KrakenTicker("ETH")
-			if err != nil {
-				Return.Kraken.ETHPrice = -1
-				Return.Kraken.ETHVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Kraken.XRPPrice, Return.Kraken.XRPVolume, err = KrakenTicker("XRP")
-			if err != nil {
-				Return.Kraken.XRPPrice = -1
-				Return.Kraken.XRPVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Kraken.LTCPrice, Return.Kraken.LTCVolume, err = KrakenTicker("LTC")
-			if err != nil {
-				Return.Kraken.LTCPrice = -1
-				Return.Kraken.LTCVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Kraken.LINKPrice, Return.Kraken.LINKVolume, err = KrakenTicker("LINK")
-			if err != nil {
-				Return.Kraken.LINKPrice = -1
-				Return.Kraken.LINKVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Kraken.ADAPrice, Return.Kraken.ADAVolume, err = KrakenTicker("ADA")
-			if err != nil {
-				Return.Kraken.ADAPrice = -1
-				Return.Kraken.ADAVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Bitfinex.BTCPrice, Return.Bitfinex.BTCVolume, err = BitfinexTicker("BTC")
-			if err != nil {
-				Return.Bitfinex.BTCPrice = -1
-				Return.Bitfinex.BTCVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Bitfinex.ETHPrice, Return.Bitfinex.ETHVolume, err = BitfinexTicker("ETH")
-			if err != nil {
-				Return.Bitfinex.ETHPrice = -1
-				Return.Bitfinex.ETHVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Bitfinex.XRPPrice, Return.Bitfinex.XRPVolume, err = BitfinexTicker("XRP")
-			if err != nil {
-				Return.Bitfinex.XRPPrice = -1
-				Return.Bitfinex.XRPVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Bitfinex.LTCPrice, Return.Bitfinex.LTCVolume, err = BitfinexTicker("LTC")
-			if err != nil {
-				Return.Bitfinex.LTCPrice = -1
-				Return.Bitfinex.LTCVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Bitfinex.LINKPrice, Return.Bitfinex.LINKVolume, err = BitfinexTicker("LINK")
-			if err != nil {
-				Return.Bitfinex.LINKPrice = -1
-				Return.Bitfinex.LINKVolume = -1
-			}
-		}(&wg)
-
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			Return.Bitfinex.ADAPrice, Return.Bitfinex.ADAVolume, err = BitfinexTicker("ADA")
-			if err != nil {
-				Return.Bitfinex.ADAPrice = -1
-				Return.Bitfinex.ADAVolume = -1
-			}
-		}(&wg)
-
-		wg.Wait()
-		templates.Lookup("doc").Execute(w, Return)
+		// the poller keeps the store up to date, so we only read the latest snapshot here
+		dashboard := buildDashboard(store.Snapshot())
+		templates.Lookup("doc").Execute(w, dashboard)
 	})
 }
 
@@ -344,20 +134,49 @@ func serveStatic() {
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 }
 
-func startServer(portx int, insecure bool) {
+// startServer serves the dashboard and the API until ctx is done, then waits for in-flight requests
+// to finish. Open event streams and websockets are closed, since their requests share ctx
+func startServer(ctx context.Context, portx int, insecure bool) error {
 	frontend()
 	serveStatic()
+	setupAPI()
+	serveEvents()
+	serveWS()
+	serveCharts()
+	serveMetrics()
 
 	port, err := utils.ToString(portx)
 	if err != nil {
 		log.Fatal("Port not string")
 	}
 
-	log.Println("Starting RPC Server on Port: ", port)
-	if insecure {
-		log.Println("starting server in insecure mode")
-		log.Fatal(http.ListenAndServe(":"+port, nil))
-	} else {
-		log.Fatal(http.ListenAndServeTLS(":"+port, "certs/server.crt", "certs/server.key", nil))
+	server := &http.Server{
+		Addr:        ":" + port,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	errs := make(chan error, 1)
+	go func() {
+		log.Println("Starting RPC Server on Port: ", port)
+		if insecure {
+			log.Println("starting server in insecure mode")
+			errs <- server.ListenAndServe()
+		} else {
+			errs <- server.ListenAndServeTLS("certs/server.crt", "certs/server.key")
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		return errors.Wrap(err, "could not shut down server cleanly")
 	}
+	return nil
 }
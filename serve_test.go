@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// frontendOnce registers the dashboard handler, since handlers can only be registered once
+var frontendOnce sync.Once
+
+func TestBuildDashboard(t *testing.T) {
+	testConfig(t, baseConfig+"stale: 1m\n")
+	btc := Pair{Base: "BTC", Quote: "USD"}
+	ada := Pair{Base: "ADA", Quote: "USD"}
+
+	snapshot := NewSnapshot(time.Now())
+	snapshot.set("Binance", btc, NewQuote(100, 1))
+	old := NewQuote(101, 1)
+	old.Time = time.Now().Add(-time.Hour)
+	snapshot.set("Kraken", btc, old)
+	dashboard := buildDashboard(snapshot)
+
+	if len(dashboard.Exchanges) != 4 || dashboard.Exchanges[0].Exchange != "Binance" {
+		t.Fatalf("exchanges = %v, want the four configured exchanges in order", dashboard.Exchanges)
+	}
+	for _, row := range dashboard.Rows {
+		switch row.Pair {
+		case btc:
+			want := []Status{StatusOK, StatusError, StatusStale, StatusError}
+			for i, quote := range row.Quotes {
+				if quote.Status != want[i] {
+					t.Errorf("BTC on %s has status %s, want %s", dashboard.Exchanges[i].Exchange, quote.Status, want[i])
+				}
+			}
+		case ada:
+			// ADA isn't listed on Coinbase
+			if row.Quotes[1].Status != StatusUnsupported {
+				t.Errorf("ADA on Coinbase has status %s, want unsupported", row.Quotes[1].Status)
+			}
+		}
+	}
+}
+
+// TestFrontendConcurrent loads the dashboard from several clients while the store is being
+// updated. It's meant to be run with -race
+func TestFrontendConcurrent(t *testing.T) {
+	testConfig(t, baseConfig)
+	store = NewStore()
+	frontendOnce.Do(frontend)
+	server := httptest.NewServer(http.DefaultServeMux)
+	defer server.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			store.Publish(testSnapshot(float64(100 + i)))
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				res, err := http.Get(server.URL + "/")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				body, err := ioutil.ReadAll(res.Body)
+				res.Body.Close()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `data-pair="ETH/USD"`) {
+					t.Errorf("got status %d without the ETH/USD row", res.StatusCode)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	<-done
+}
+
+func TestFrontendEscapesErrors(t *testing.T) {
+	testConfig(t, baseConfig)
+	store = NewStore()
+	frontendOnce.Do(frontend)
+	snapshot := NewSnapshot(time.Now())
+	snapshot.set("Kraken", Pair{Base: "BTC", Quote: "USD"}, Quote{Status: StatusError, Error: `got status 502: "><script>alert(1)</script>`, Time: time.Now()})
+	store.Publish(snapshot)
+
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := w.Body.String()
+	if strings.Contains(body, "<script>alert") {
+		t.Error("error from the exchange was rendered unescaped")
+	}
+	if !strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Error("error from the exchange is missing from the cell's title")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	erpc "github.com/Varunram/essentials/rpc"
+)
+
+// Spread is the gap between the cheapest and most expensive exchange for a pair
+type Spread struct {
+	Pair
+	// Low and High are the exchanges with the lowest and highest price
+	Low       string  `json:"low"`
+	LowPrice  float64 `json:"lowPrice"`
+	High      string  `json:"high"`
+	HighPrice float64 `json:"highPrice"`
+	// Spread is the absolute difference in price, and Percent is the difference relative to the lowest price
+	Spread  float64 `json:"spread"`
+	Percent float64 `json:"percent"`
+	// Net is the percentage that would be made buying on Low and selling on High after paying taker fees
+	Net float64 `json:"net"`
+	// Arbitrage is set if Net exceeds the configured threshold
+	Arbitrage bool `json:"arbitrage"`
+}
+
+// venueQuote is a quote for a pair along with the exchange it came from
+type venueQuote struct {
+	Exchange string
+	Quote
+}
+
+// freshQuotes returns the quotes for a pair that can be compared across exchanges, leaving out
+// stale, failed, unlisted and suspect quotes
+func freshQuotes(snapshot *Snapshot, pair Pair) []venueQuote {
+	candidates := okQuotes(snapshot, pair)
+	suspect := outliers(candidates)
+
+	var list []venueQuote
+	for _, quote := range candidates {
+		if _, ok := suspect[quote.Exchange]; !ok {
+			list = append(list, quote)
+		}
+	}
+	return list
+}
+
+// okQuotes returns the quotes for a pair that were fetched successfully and aren't stale
+func okQuotes(snapshot *Snapshot, pair Pair) []venueQuote {
+	var list []venueQuote
+	for _, exchange := range exchanges {
+		quote := currentQuote(snapshot, exchange, pair)
+		if quote.Status == StatusOK {
+			list = append(list, venueQuote{Exchange: exchange.Name(), Quote: quote})
+		}
+	}
+	return list
+}
+
+// computeSpread compares the price of a pair across exchanges. Only fresh quotes are compared, and
+// false is returned if fewer than two exchanges have one
+func computeSpread(snapshot *Snapshot, pair Pair) (Spread, bool) {
+	spread := Spread{Pair: pair}
+	quotes := freshQuotes(snapshot, pair)
+	for i, quote := range quotes {
+		if i == 0 || quote.Price < spread.LowPrice {
+			spread.Low, spread.LowPrice = quote.Exchange, quote.Price
+		}
+		if i == 0 || quote.Price > spread.HighPrice {
+			spread.High, spread.HighPrice = quote.Exchange, quote.Price
+		}
+	}
+	if len(quotes) < 2 || spread.LowPrice <= 0 {
+		return spread, false
+	}
+
+	spread.Spread = spread.HighPrice - spread.LowPrice
+	spread.Percent = 100 * spread.Spread / spread.LowPrice
+
+	cost := spread.LowPrice * (1 + config.fee(spread.Low))
+	proceeds := spread.HighPrice * (1 - config.fee(spread.High))
+	spread.Net = 100 * (proceeds - cost) / cost
+	spread.Arbitrage = spread.Net > config.Arbitrage.Threshold
+	return spread, true
+}
+
+// SpreadsResponse is the response to /api/v1/spreads and /api/v1/spreads/{asset}
+type SpreadsResponse struct {
+	Updated   time.Time `json:"updated"`
+	Threshold float64   `json:"threshold"`
+	Spreads   []Spread  `json:"spreads"`
+}
+
+// getSpreads serves /api/v1/spreads and /api/v1/spreads/{asset}, listing the spread of every pair
+// that's quoted on at least two exchanges
+func getSpreads() {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if !checkGet(w, req) {
+			return
+		}
+
+		asset := strings.ToUpper(strings.Trim(strings.TrimPrefix(req.URL.Path, "/api/v1/spreads"), "/"))
+		if asset != "" && !contains(config.Assets, asset) {
+			erpc.ResponseHandler(w, erpc.StatusNotFound, "asset not found")
+			return
+		}
+
+		snapshot := store.Snapshot()
+		response := SpreadsResponse{Updated: snapshot.Time, Threshold: config.Arbitrage.Threshold, Spreads: []Spread{}}
+		for _, pair := range config.Pairs() {
+			if asset != "" && pair.Base != asset {
+				continue
+			}
+			if spread, ok := computeSpread(snapshot, pair); ok {
+				response.Spreads = append(response.Spreads, spread)
+			}
+		}
+		writeJSON(w, response)
+	}
+
+	http.HandleFunc("/api/v1/spreads", handler)
+	http.HandleFunc("/api/v1/spreads/", handler)
+}
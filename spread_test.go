@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// spreadConfig quotes BTC/USD on every exchange with taker fees and an arbitrage threshold
+var spreadConfig = `
+assets: [BTC]
+quotes: [USD]
+exchanges: [binance, coinbase, kraken, bitfinex]
+stale: 1m
+arbitrage:
+  threshold: 0.5
+  fees:
+    binance: 0.1
+    coinbase: 0.5
+    kraken: 0.26
+    bitfinex: 0.2
+outliers:
+  percent: 5
+`
+
+// btcQuotes returns a snapshot with the passed BTC/USD quotes, keyed by exchange
+func btcQuotes(quotes map[string]Quote) *Snapshot {
+	snapshot := NewSnapshot(time.Now())
+	for exchange, quote := range quotes {
+		snapshot.set(exchange, btcUSD, quote)
+	}
+	return snapshot
+}
+
+// near checks whether two computed prices are equal, give or take rounding
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestComputeSpread(t *testing.T) {
+	testConfig(t, spreadConfig)
+	stale := NewQuote(90, 1)
+	stale.Time = time.Now().Add(-time.Hour)
+
+	for _, test := range []struct {
+		name      string
+		quotes    map[string]Quote
+		ok        bool
+		low, high string
+		net       float64
+		arbitrage bool
+	}{
+		{
+			name:   "net of kraken's and binance's fees",
+			quotes: map[string]Quote{"Kraken": NewQuote(100, 1), "Binance": NewQuote(102, 1)},
+			ok:     true, low: "Kraken", high: "Binance",
+			net:       100 * (102*0.999 - 100*1.0026) / (100 * 1.0026),
+			arbitrage: true,
+		},
+		{
+			name:   "fees eat the spread",
+			quotes: map[string]Quote{"Kraken": NewQuote(100, 1), "Binance": NewQuote(100.5, 1)},
+			ok:     true, low: "Kraken", high: "Binance",
+			net: 100 * (100.5*0.999 - 100*1.0026) / (100 * 1.0026),
+		},
+		{
+			name:   "losing after fees",
+			quotes: map[string]Quote{"Coinbase": NewQuote(100, 1), "Bitfinex": NewQuote(100.1, 1)},
+			ok:     true, low: "Coinbase", high: "Bitfinex",
+			net: 100 * (100.1*0.998 - 100*1.005) / (100 * 1.005),
+		},
+		{
+			name:   "stale quotes are skipped",
+			quotes: map[string]Quote{"Kraken": NewQuote(100, 1), "Binance": stale},
+		},
+		{
+			name:   "failed quotes are skipped",
+			quotes: map[string]Quote{"Kraken": NewQuote(100, 1), "Binance": ErrorQuote(errors.New("unavailable"))},
+		},
+		{
+			name: "suspect quotes are skipped",
+			quotes: map[string]Quote{"Kraken": NewQuote(100, 1), "Binance": NewQuote(101, 1),
+				"Coinbase": NewQuote(100.5, 1), "Bitfinex": NewQuote(150, 1)},
+			ok: true, low: "Kraken", high: "Binance",
+			net:       100 * (101*0.999 - 100*1.0026) / (100 * 1.0026),
+			arbitrage: true,
+		},
+	} {
+		spread, ok := computeSpread(btcQuotes(test.quotes), btcUSD)
+		if ok != test.ok {
+			t.Errorf("%s: got spread %+v, %v", test.name, spread, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if spread.Low != test.low || spread.High != test.high || !near(spread.Net, test.net) || spread.Arbitrage != test.arbitrage {
+			t.Errorf("%s: got spread %+v, want %s to %s netting %v", test.name, spread, test.low, test.high, test.net)
+		}
+		if want := 100 * (spread.HighPrice - spread.LowPrice) / spread.LowPrice; !near(spread.Percent, want) {
+			t.Errorf("%s: got percent %v, want %v", test.name, spread.Percent, want)
+		}
+	}
+}
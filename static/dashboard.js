@@ -0,0 +1,107 @@
+// dashboard.js keeps the table up to date with the quote changes pushed by the server on /events
+(function () {
+    var headers = document.querySelectorAll("th[data-exchange]");
+    var exchanges = Array.prototype.map.call(headers, function (th) {
+        return th.getAttribute("data-exchange");
+    });
+
+    function render(cell, value, quote) {
+        cell.className = quote.status;
+        cell.removeAttribute("title");
+        if (quote.status === "ok" || quote.status === "stale" || quote.status === "suspect") {
+            cell.textContent = value;
+            if (quote.error) {
+                cell.title = quote.error;
+            }
+        } else if (quote.status === "unsupported") {
+            cell.textContent = "not listed";
+        } else {
+            cell.textContent = "unavailable";
+            cell.title = quote.error || "";
+        }
+    }
+
+    function formatTime(time) {
+        return new Date(time).toISOString().replace("T", " ").slice(0, 19) + " UTC";
+    }
+
+    var source = new EventSource("/events");
+    source.addEventListener("quote", function (event) {
+        var update = JSON.parse(event.data);
+        var index = exchanges.indexOf(update.exchange);
+        var row = document.querySelector('tr[data-pair="' + update.asset + "/" + update.quote + '"]');
+        if (index < 0 || !row) {
+            return;
+        }
+
+        // the first cell is the pair, followed by a price and volume cell for each exchange
+        var cells = row.querySelectorAll("td");
+        render(cells[1 + 2 * index], update.ticker.price, update.ticker);
+        render(cells[2 + 2 * index], update.ticker.volume, update.ticker);
+        document.getElementById("updated").textContent = formatTime(update.ticker.time);
+    });
+
+    source.addEventListener("breaker", function (event) {
+        var breaker = JSON.parse(event.data);
+        var index = exchanges.indexOf(breaker.exchange);
+        if (index < 0) {
+            return;
+        }
+
+        var header = headers[index];
+        header.className = "breaker-" + breaker.state;
+        if (breaker.state === "closed") {
+            header.removeAttribute("title");
+        } else {
+            header.title = "circuit breaker " + breaker.state + ": " + breaker.error;
+        }
+    });
+
+    function renderMissing(cell) {
+        cell.className = "unsupported";
+        cell.removeAttribute("title");
+        cell.textContent = "n/a";
+    }
+
+    source.addEventListener("aggregate", function (event) {
+        var update = JSON.parse(event.data);
+        var row = document.querySelector('tr[data-pair="' + update.asset + "/" + update.quote + '"]');
+        if (!row) {
+            return;
+        }
+
+        // quotes that were suspect may have been cleared by another exchange's update
+        var cells = row.querySelectorAll("td");
+        exchanges.forEach(function (exchange, i) {
+            if (cells[1 + 2 * i].className === "suspect" && update.suspect.indexOf(exchange) < 0) {
+                cells[1 + 2 * i].className = "ok";
+                cells[2 + 2 * i].className = "ok";
+                cells[1 + 2 * i].removeAttribute("title");
+                cells[2 + 2 * i].removeAttribute("title");
+            } else if (cells[1 + 2 * i].className === "ok" && update.suspect.indexOf(exchange) >= 0) {
+                cells[1 + 2 * i].className = "suspect";
+                cells[2 + 2 * i].className = "suspect";
+            }
+        });
+
+        var cell = row.querySelector("td[data-index]");
+        var index = update.index;
+        if (!index) {
+            renderMissing(cell);
+        } else {
+            cell.className = "";
+            cell.title = index.method + " of " + index.exchanges.length + " exchanges";
+            cell.textContent = Number(index.price.toPrecision(6));
+        }
+
+        cell = row.querySelector("td[data-spread]");
+        var spread = update.spread;
+        if (!spread) {
+            renderMissing(cell);
+        } else {
+            cell.className = spread.arbitrage ? "arbitrage" : "";
+            cell.title = "buy on " + spread.low + ", sell on " + spread.high + ": " + spread.net.toFixed(2) + "% after fees";
+            cell.textContent = spread.percent.toFixed(2) + "%";
+        }
+    });
+})();
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Snapshot is the ticker data from a single poll of every exchange. Snapshots are never modified
+// once they're published to the store, so they can be read without holding a lock
+type Snapshot struct {
+	Time   time.Time
+	Quotes map[string]map[Pair]Quote
+}
+
+// NewSnapshot returns an empty snapshot taken at the passed time
+func NewSnapshot(t time.Time) *Snapshot {
+	return &Snapshot{Time: t, Quotes: make(map[string]map[Pair]Quote)}
+}
+
+// set stores the data for a pair on an exchange. This must only be called before the snapshot is published
+func (s *Snapshot) set(exchange string, pair Pair, quote Quote) {
+	if s.Quotes[exchange] == nil {
+		s.Quotes[exchange] = make(map[Pair]Quote)
+	}
+	s.Quotes[exchange][pair] = quote
+}
+
+// Get returns the data for a pair on an exchange
+func (s *Snapshot) Get(exchange string, pair Pair) (Quote, bool) {
+	quote, ok := s.Quotes[exchange][pair]
+	return quote, ok
+}
+
+// clone returns a copy of the snapshot that can be modified without affecting readers of the original
+func (s *Snapshot) clone() *Snapshot {
+	c := NewSnapshot(s.Time)
+	for exchange, quotes := range s.Quotes {
+		c.Quotes[exchange] = make(map[Pair]Quote, len(quotes))
+		for pair, quote := range quotes {
+			c.Quotes[exchange][pair] = quote
+		}
+	}
+	return c
+}
+
+// Update is sent to subscribers of the store whenever a quote changes
+type Update struct {
+	Exchange string `json:"exchange"`
+	Pair
+	Ticker Quote `json:"ticker"`
+}
+
+// Store is a thread safe holder of the latest snapshot
+type Store struct {
+	sync.RWMutex
+	snapshot    *Snapshot
+	subscribers map[chan Update]bool
+}
+
+// store is the cache that the poller writes to and the frontend reads from
+var store = NewStore()
+
+// NewStore returns a store holding an empty snapshot
+func NewStore() *Store {
+	return &Store{snapshot: NewSnapshot(time.Time{}), subscribers: make(map[chan Update]bool)}
+}
+
+// Publish merges the quotes in snapshot into the latest snapshot. Quotes for exchanges or pairs
+// that aren't in the passed snapshot, eg those kept up to date by a stream, are left as they are
+func (s *Store) Publish(snapshot *Snapshot) {
+	s.Lock()
+	defer s.Unlock()
+	merged := s.snapshot.clone()
+	merged.Time = snapshot.Time
+	for exchange, quotes := range snapshot.Quotes {
+		for pair, quote := range quotes {
+			s.notify(exchange, pair, quote)
+			merged.set(exchange, pair, quote)
+		}
+	}
+	s.snapshot = merged
+}
+
+// Set updates the data for a single pair on an exchange, publishing a new snapshot
+func (s *Store) Set(exchange string, pair Pair, quote Quote) {
+	s.Lock()
+	defer s.Unlock()
+	s.notify(exchange, pair, quote)
+	snapshot := s.snapshot.clone()
+	snapshot.Time = time.Now()
+	snapshot.set(exchange, pair, quote)
+	s.snapshot = snapshot
+}
+
+// Snapshot returns the latest snapshot
+func (s *Store) Snapshot() *Snapshot {
+	s.RLock()
+	defer s.RUnlock()
+	return s.snapshot
+}
+
+// Subscribe returns a channel that receives an update whenever a quote changes. Updates are
+// dropped if the channel's buffer is full, so a slow subscriber can't hold up the store
+func (s *Store) Subscribe(buffer int) chan Update {
+	s.Lock()
+	defer s.Unlock()
+	ch := make(chan Update, buffer)
+	s.subscribers[ch] = true
+	return ch
+}
+
+// Unsubscribe stops sending updates to a channel returned by Subscribe and closes it
+func (s *Store) Unsubscribe(ch chan Update) {
+	s.Lock()
+	defer s.Unlock()
+	if s.subscribers[ch] {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
+
+// notify sends an update to every subscriber if the quote differs from the one in the latest
+// snapshot. It must be called with the lock held
+func (s *Store) notify(exchange string, pair Pair, quote Quote) {
+	if len(s.subscribers) == 0 {
+		return
+	}
+
+	old, ok := s.snapshot.Get(exchange, pair)
+	if ok && old.Price == quote.Price && old.Volume == quote.Volume && old.Status == quote.Status {
+		return
+	}
+
+	update := Update{Exchange: exchange, Pair: pair, Ticker: quote}
+	for ch := range s.subscribers {
+		select {
+		case ch <- update:
+		default:
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConfig loads a config for tests from the passed YAML
+func testConfig(t *testing.T, data string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// baseConfig is a config with a few pairs on every exchange
+var baseConfig = `
+assets: [BTC, ETH, ADA]
+quotes: [USD]
+exchanges: [binance, coinbase, kraken, bitfinex]
+interval: 1s
+`
+
+// testSnapshot returns a snapshot with a quote for every pair on every exchange, priced off base
+func testSnapshot(base float64) *Snapshot {
+	snapshot := NewSnapshot(time.Now())
+	for i, exchange := range exchanges {
+		for _, pair := range config.Pairs() {
+			snapshot.set(exchange.Name(), pair, NewQuote(base+float64(i), 10))
+		}
+	}
+	return snapshot
+}
+
+func TestStorePublishMerges(t *testing.T) {
+	testConfig(t, baseConfig)
+	s := NewStore()
+	btc := Pair{Base: "BTC", Quote: "USD"}
+	eth := Pair{Base: "ETH", Quote: "USD"}
+
+	first := NewSnapshot(time.Now())
+	first.set("Kraken", btc, NewQuote(100, 1))
+	first.set("Kraken", eth, NewQuote(10, 1))
+	s.Publish(first)
+
+	second := NewSnapshot(time.Now())
+	second.set("Kraken", btc, NewQuote(101, 1))
+	s.Publish(second)
+
+	snapshot := s.Snapshot()
+	if quote, _ := snapshot.Get("Kraken", btc); quote.Price != 101 {
+		t.Errorf("BTC price = %v, want 101", quote.Price)
+	}
+	if quote, ok := snapshot.Get("Kraken", eth); !ok || quote.Price != 10 {
+		t.Errorf("ETH quote = %v, %v, want it kept from the first snapshot", quote, ok)
+	}
+	// published snapshots are never modified
+	if quote, _ := first.Get("Kraken", btc); quote.Price != 100 {
+		t.Errorf("first snapshot was modified: BTC price = %v", quote.Price)
+	}
+}
+
+func TestStoreSubscribe(t *testing.T) {
+	testConfig(t, baseConfig)
+	s := NewStore()
+	updates := s.Subscribe(10)
+	pair := Pair{Base: "BTC", Quote: "USD"}
+	quote := NewQuote(100, 1)
+
+	s.Set("Kraken", pair, quote)
+	s.Set("Kraken", pair, quote)
+	quote.Price = 101
+	s.Set("Kraken", pair, quote)
+	s.Unsubscribe(updates)
+
+	var prices []float64
+	for update := range updates {
+		prices = append(prices, update.Ticker.Price)
+	}
+	if len(prices) != 2 || prices[0] != 100 || prices[1] != 101 {
+		t.Errorf("got updates for prices %v, want [100 101] since unchanged quotes aren't sent", prices)
+	}
+}
+
+// TestStoreConcurrent publishes snapshots while dashboards are built from the store. It's meant
+// to be run with -race
+func TestStoreConcurrent(t *testing.T) {
+	testConfig(t, baseConfig)
+	store = NewStore()
+	updates := store.Subscribe(16)
+	defer store.Unsubscribe(updates)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				store.Publish(testSnapshot(float64(100 * (i + j))))
+				store.Set("Kraken", Pair{Base: "BTC", Quote: "USD"}, NewQuote(float64(j), 1))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				dashboard := buildDashboard(store.Snapshot())
+				if len(dashboard.Rows) != len(config.Pairs()) {
+					t.Errorf("got %d rows, want %d", len(dashboard.Rows), len(config.Pairs()))
+					return
+				}
+				for _, row := range dashboard.Rows {
+					if len(row.Quotes) != len(exchanges) {
+						t.Errorf("got %d quotes for %s, want %d", len(row.Quotes), row.Pair, len(exchanges))
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if store.Snapshot().Time.IsZero() {
+		t.Error("nothing was published")
+	}
+	if len(updates) == 0 {
+		t.Error("subscriber got no updates")
+	}
+}
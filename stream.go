@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	errors "github.com/pkg/errors"
+
+	utils "github.com/Varunram/essentials/utils"
+)
+
+// BinanceStream is binance's combined stream endpoint, formatted with the streams to subscribe to
+var BinanceStream = "wss://stream.binance.com:9443/stream?streams=%s"
+
+// CoinbaseStream is coinbase's websocket feed
+var CoinbaseStream = "wss://ws-feed.pro.coinbase.com"
+
+// KrakenStream is kraken's public websocket feed
+var KrakenStream = "wss://ws.kraken.com"
+
+// BitfinexStream is bitfinex's public websocket feed
+var BitfinexStream = "wss://api-pub.bitfinex.com/ws/2"
+
+var (
+	// streamTimeout is how long a stream can go without a message before we reconnect
+	streamTimeout = time.Minute
+	// minBackoff is how long we wait before reconnecting a dropped stream the first time
+	minBackoff = time.Second
+	// maxBackoff is the longest we wait before reconnecting a dropped stream
+	maxBackoff = time.Minute
+)
+
+// Streamer is implemented by exchanges that publish tickers over a websocket
+type Streamer interface {
+	Exchange
+	// Feed returns a feed for the passed pairs. A new feed is created for every connection,
+	// so feeds can keep per connection state like channel ids
+	Feed(pairs []Pair) Feed
+}
+
+// Feed is a single websocket connection's subscription to an exchange's tickers
+type Feed interface {
+	// URL returns the websocket endpoint to connect to
+	URL() string
+	// Subscribe sends the messages needed to subscribe to the feed's tickers
+	Subscribe(conn *websocket.Conn) error
+	// Handle parses a message from the exchange, returning the quotes it contains
+	Handle(msg []byte) (map[Pair]Quote, error)
+}
+
+// startStreams connects to the websocket feed of every exchange that has one until ctx is done,
+// and returns the exchanges that are being streamed
+func startStreams(ctx context.Context) []Exchange {
+	var streaming []Exchange
+	for _, exchange := range exchanges {
+		streamer, ok := exchange.(Streamer)
+		if !ok {
+			continue
+		}
+
+		var pairs []Pair
+		for _, pair := range config.Pairs() {
+			if listed(exchange, pair.Base) {
+				pairs = append(pairs, pair)
+			}
+		}
+		if len(pairs) == 0 {
+			continue
+		}
+
+		streaming = append(streaming, exchange)
+		go stream(ctx, streamer, pairs)
+	}
+	return streaming
+}
+
+// stream keeps a websocket connection to the exchange open, reconnecting and resubscribing with
+// an exponential backoff whenever it drops
+func stream(ctx context.Context, exchange Streamer, pairs []Pair) {
+	backoff := minBackoff
+	for {
+		received, err := streamOnce(ctx, exchange, exchange.Feed(pairs))
+		if received {
+			backoff = minBackoff
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Println("stream from", exchange.Name(), "dropped, reconnecting in", backoff, err)
+		if sleep(ctx, backoff) != nil {
+			return
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// streamOnce connects to a feed and writes its quotes to the store until the connection drops.
+// It returns whether any quotes were received before the connection dropped
+func streamOnce(ctx context.Context, exchange Streamer, feed Feed) (bool, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, feed.URL(), nil)
+	if err != nil {
+		return false, errors.Wrap(err, "could not connect to stream")
+	}
+	defer conn.Close()
+
+	// closing the connection unblocks the read below when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	err = feed.Subscribe(conn)
+	if err != nil {
+		return false, errors.Wrap(err, "could not subscribe to stream")
+	}
+
+	log.Println("streaming tickers from", exchange.Name())
+	received := false
+	for {
+		conn.SetReadDeadline(time.Now().Add(streamTimeout))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return received, err
+		}
+
+		quotes, err := feed.Handle(msg)
+		if len(quotes) != 0 || err != nil {
+			countFetch(exchange.Name(), err != nil)
+		}
+		if err != nil {
+			log.Println("could not parse message from", exchange.Name(), err)
+			continue
+		}
+		for pair, quote := range quotes {
+			store.Set(exchange.Name(), pair, quote)
+			received = true
+		}
+	}
+}
+
+// parseQuote converts the price and volume strings sent by an exchange to a quote
+func parseQuote(price string, volume string) (Quote, error) {
+	p, err := utils.ToFloat(price)
+	if err != nil {
+		return Quote{}, errors.Wrap(err, "could not convert price from string to float")
+	}
+	v, err := utils.ToFloat(volume)
+	if err != nil {
+		return Quote{}, errors.Wrap(err, "could not convert volume from string to float")
+	}
+	return NewQuote(math.Round(p*1000)/1000, math.Round(v*1000)/1000), nil
+}
+
+// Feed returns a feed of Binance's 24hr ticker streams
+func (Binance) Feed(pairs []Pair) Feed {
+	return &binanceFeed{pairs: pairs}
+}
+
+type binanceFeed struct {
+	pairs []Pair
+}
+
+// binanceStreamMessage is a message on binance's combined stream
+type binanceStreamMessage struct {
+	Stream string `json:"stream"`
+	Data   struct {
+		Symbol    string `json:"s"`
+		LastPrice string `json:"c"`
+		Volume    string `json:"v"`
+	} `json:"data"`
+}
+
+func (f *binanceFeed) URL() string {
+	streams := make([]string, len(f.pairs))
+	for i, pair := range f.pairs {
+		streams[i] = strings.ToLower(BinanceSymbols.Symbol(pair)) + "@ticker"
+	}
+	return fmt.Sprintf(BinanceStream, strings.Join(streams, "/"))
+}
+
+// Subscribe doesn't need to do anything since the streams are part of the url
+func (f *binanceFeed) Subscribe(conn *websocket.Conn) error {
+	return nil
+}
+
+func (f *binanceFeed) Handle(msg []byte) (map[Pair]Quote, error) {
+	var message binanceStreamMessage
+	err := json.Unmarshal(msg, &message)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal message")
+	}
+
+	pair, ok := BinanceSymbols.Parse(message.Data.Symbol, f.pairs)
+	if !ok {
+		return nil, nil
+	}
+	quote, err := parseQuote(message.Data.LastPrice, message.Data.Volume)
+	if err != nil {
+		return nil, err
+	}
+	return map[Pair]Quote{pair: quote}, nil
+}
+
+// Feed returns a feed of Coinbase's ticker channel
+func (Coinbase) Feed(pairs []Pair) Feed {
+	return &coinbaseFeed{pairs: pairs}
+}
+
+type coinbaseFeed struct {
+	pairs []Pair
+}
+
+// coinbaseStreamMessage is a message on coinbase's websocket feed
+type coinbaseStreamMessage struct {
+	Type      string `json:"type"`
+	ProductID string `json:"product_id"`
+	Price     string `json:"price"`
+	Volume    string `json:"volume_24h"`
+	Message   string `json:"message"`
+}
+
+func (f *coinbaseFeed) URL() string {
+	return CoinbaseStream
+}
+
+func (f *coinbaseFeed) Subscribe(conn *websocket.Conn) error {
+	products := make([]string, len(f.pairs))
+	for i, pair := range f.pairs {
+		products[i] = CoinbaseSymbols.Symbol(pair)
+	}
+	return conn.WriteJSON(map[string]interface{}{
+		"type":        "subscribe",
+		"product_ids": products,
+		"channels":    []string{"ticker"},
+	})
+}
+
+func (f *coinbaseFeed) Handle(msg []byte) (map[Pair]Quote, error) {
+	var message coinbaseStreamMessage
+	err := json.Unmarshal(msg, &message)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal message")
+	}
+
+	if message.Type == "error" {
+		return nil, errors.New(message.Message)
+	}
+	if message.Type != "ticker" {
+		// subscription confirmations and heartbeats
+		return nil, nil
+	}
+
+	pair, ok := CoinbaseSymbols.Parse(message.ProductID, f.pairs)
+	if !ok {
+		return nil, nil
+	}
+	quote, err := parseQuote(message.Price, message.Volume)
+	if err != nil {
+		return nil, err
+	}
+	return map[Pair]Quote{pair: quote}, nil
+}
+
+// Feed returns a feed of Kraken's ticker channel
+func (Kraken) Feed(pairs []Pair) Feed {
+	return &krakenFeed{pairs: pairs}
+}
+
+type krakenFeed struct {
+	pairs []Pair
+}
+
+// krakenStreamTicker is the ticker object in a kraken channel message
+type krakenStreamTicker struct {
+	C []string // c = last trade closed array(<price>, <lot volume>),
+	V []string // volume array(<today>, <last 24 hours>)
+}
+
+func (f *krakenFeed) URL() string {
+	return KrakenStream
+}
+
+func (f *krakenFeed) Subscribe(conn *websocket.Conn) error {
+	// kraken's websocket api separates the assets in a pair with a slash, eg XBT/USD
+	names := make([]string, len(f.pairs))
+	for i, pair := range f.pairs {
+		names[i] = KrakenSymbols.asset(pair.Base) + "/" + KrakenSymbols.asset(pair.Quote)
+	}
+	return conn.WriteJSON(map[string]interface{}{
+		"event":        "subscribe",
+		"pair":         names,
+		"subscription": map[string]string{"name": "ticker"},
+	})
+}
+
+func (f *krakenFeed) Handle(msg []byte) (map[Pair]Quote, error) {
+	// channel messages are arrays of [channelID, ticker, channelName, pair], everything
+	// else (heartbeats, status updates) is an object
+	if !bytes.HasPrefix(bytes.TrimSpace(msg), []byte("[")) {
+		return nil, nil
+	}
+
+	var message []json.RawMessage
+	err := json.Unmarshal(msg, &message)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal message")
+	}
+	if len(message) < 4 {
+		return nil, errors.New("malformed message from Kraken")
+	}
+
+	var name string
+	err = json.Unmarshal(message[len(message)-1], &name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal pair")
+	}
+	pair, ok := KrakenSymbols.Parse(name, f.pairs)
+	if !ok {
+		return nil, nil
+	}
+
+	var ticker krakenStreamTicker
+	err = json.Unmarshal(message[1], &ticker)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal ticker")
+	}
+	if len(ticker.C) < 1 || len(ticker.V) < 2 {
+		return nil, errors.New("malformed ticker from Kraken")
+	}
+
+	quote, err := parseQuote(ticker.C[0], ticker.V[1])
+	if err != nil {
+		return nil, err
+	}
+	return map[Pair]Quote{pair: quote}, nil
+}
+
+// Feed returns a feed of Bitfinex's ticker channels
+func (Bitfinex) Feed(pairs []Pair) Feed {
+	return &bitfinexFeed{pairs: pairs, channels: make(map[int]Pair)}
+}
+
+type bitfinexFeed struct {
+	pairs []Pair
+	// channels maps the channel ids assigned by bitfinex to the pairs we subscribed to
+	channels map[int]Pair
+}
+
+// bitfinexEvent is an event message on bitfinex's websocket feed
+type bitfinexEvent struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	ChanID  int    `json:"chanId"`
+	Symbol  string `json:"symbol"`
+	Msg     string `json:"msg"`
+}
+
+func (f *bitfinexFeed) URL() string {
+	return BitfinexStream
+}
+
+func (f *bitfinexFeed) Subscribe(conn *websocket.Conn) error {
+	// bitfinex needs a subscription per pair
+	for _, pair := range f.pairs {
+		err := conn.WriteJSON(map[string]string{
+			"event":   "subscribe",
+			"channel": "ticker",
+			"symbol":  BitfinexSymbols.Symbol(pair),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *bitfinexFeed) Handle(msg []byte) (map[Pair]Quote, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(msg), []byte("[")) {
+		var event bitfinexEvent
+		err := json.Unmarshal(msg, &event)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not unmarshal event")
+		}
+
+		switch event.Event {
+		case "subscribed":
+			pair, ok := BitfinexSymbols.Parse(event.Symbol, f.pairs)
+			if ok {
+				f.channels[event.ChanID] = pair
+			}
+		case "error":
+			return nil, errors.New(event.Msg)
+		}
+		return nil, nil
+	}
+
+	// channel messages are [chanId, [BID, BID_SIZE, ASK, ASK_SIZE, DAILY_CHANGE, DAILY_CHANGE_RELATIVE,
+	// LAST_PRICE, VOLUME, HIGH, LOW]] or [chanId, "hb"] for heartbeats
+	var message []json.RawMessage
+	err := json.Unmarshal(msg, &message)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal message")
+	}
+	if len(message) < 2 || !bytes.HasPrefix(message[1], []byte("[")) {
+		return nil, nil
+	}
+
+	var chanID int
+	err = json.Unmarshal(message[0], &chanID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal channel id")
+	}
+	pair, ok := f.channels[chanID]
+	if !ok {
+		return nil, nil
+	}
+
+	var ticker []float64
+	err = json.Unmarshal(message[1], &ticker)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal ticker")
+	}
+	if len(ticker) < 8 {
+		return nil, errors.New("malformed ticker from Bitfinex")
+	}
+
+	quote := NewQuote(math.Round(ticker[6]*1000)/1000, math.Round(ticker[7]*1000)/1000)
+	return map[Pair]Quote{pair: quote}, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	btcUSD = Pair{Base: "BTC", Quote: "USD"}
+	ethUSD = Pair{Base: "ETH", Quote: "USD"}
+)
+
+// mockStream starts a websocket server that runs handle for every connection, returning its ws:// url
+func mockStream(t *testing.T, handle func(conn *websocket.Conn, req *http.Request)) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		handle(conn, req)
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// readJSON reads a JSON message sent by a feed. It runs on the server's goroutine, so it can't stop the test
+func readJSON(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	var msg map[string]interface{}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	err := conn.ReadJSON(&msg)
+	if err != nil {
+		t.Error("feed didn't subscribe:", err)
+	}
+	return msg
+}
+
+// streamQuotes runs a feed against a mock server once, returning the quotes written to the store
+func streamQuotes(t *testing.T, exchange Streamer, feed Feed) map[Pair]Quote {
+	t.Helper()
+	store = NewStore()
+	received, err := streamOnce(context.Background(), exchange, feed)
+	if !received {
+		t.Fatal("no quotes received before the stream closed:", err)
+	}
+	return store.Snapshot().Quotes[exchange.Name()]
+}
+
+func checkQuote(t *testing.T, quotes map[Pair]Quote, pair Pair, price float64, volume float64) {
+	t.Helper()
+	quote, ok := quotes[pair]
+	if !ok {
+		t.Fatalf("no quote for %s in %v", pair, quotes)
+	}
+	if quote.Status != StatusOK || quote.Price != price || quote.Volume != volume {
+		t.Errorf("%s quote = %+v, want price %v and volume %v", pair, quote, price, volume)
+	}
+}
+
+func TestBinanceFeed(t *testing.T) {
+	defer func(url string) { BinanceStream = url }(BinanceStream)
+	BinanceStream = mockStream(t, func(conn *websocket.Conn, req *http.Request) {
+		if streams := req.URL.Query().Get("streams"); streams != "btcusdt@ticker/ethusdt@ticker" {
+			t.Errorf("subscribed to %q", streams)
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"stream":"btcusdt@ticker","data":{"s":"BTCUSDT","c":"30000.12","v":"1234.5"}}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"stream":"dogeusdt@ticker","data":{"s":"DOGEUSDT","c":"0.1","v":"1"}}`))
+	}) + "/stream?streams=%s"
+
+	quotes := streamQuotes(t, Binance{}, Binance{}.Feed([]Pair{btcUSD, ethUSD}))
+	checkQuote(t, quotes, btcUSD, 30000.12, 1234.5)
+	if len(quotes) != 1 {
+		t.Errorf("got quotes for %d pairs, want only BTC/USD", len(quotes))
+	}
+}
+
+func TestCoinbaseFeed(t *testing.T) {
+	defer func(url string) { CoinbaseStream = url }(CoinbaseStream)
+	CoinbaseStream = mockStream(t, func(conn *websocket.Conn, req *http.Request) {
+		msg := readJSON(t, conn)
+		products, _ := json.Marshal(msg["product_ids"])
+		channels, _ := json.Marshal(msg["channels"])
+		if msg["type"] != "subscribe" || string(products) != `["BTC-USD","ETH-USD"]` || string(channels) != `["ticker"]` {
+			t.Errorf("got subscription %v", msg)
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscriptions","channels":[]}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ticker","product_id":"ETH-USD","price":"2000.5","volume_24h":"300"}`))
+	})
+
+	quotes := streamQuotes(t, Coinbase{}, Coinbase{}.Feed([]Pair{btcUSD, ethUSD}))
+	checkQuote(t, quotes, ethUSD, 2000.5, 300)
+
+	_, err := Coinbase{}.Feed([]Pair{btcUSD}).Handle([]byte(`{"type":"error","message":"Failed to subscribe"}`))
+	if err == nil || err.Error() != "Failed to subscribe" {
+		t.Errorf("got error %v for an error message", err)
+	}
+}
+
+func TestKrakenFeed(t *testing.T) {
+	defer func(url string) { KrakenStream = url }(KrakenStream)
+	KrakenStream = mockStream(t, func(conn *websocket.Conn, req *http.Request) {
+		msg := readJSON(t, conn)
+		pairs, _ := json.Marshal(msg["pair"])
+		subscription, _ := json.Marshal(msg["subscription"])
+		if msg["event"] != "subscribe" || string(pairs) != `["XBT/USD","ETH/USD"]` || string(subscription) != `{"name":"ticker"}` {
+			t.Errorf("got subscription %v", msg)
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"heartbeat"}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`[340,{"c":["29990.5","0.01"],"v":["100.1","250.25"]},"ticker","XBT/USD"]`))
+	})
+
+	quotes := streamQuotes(t, Kraken{}, Kraken{}.Feed([]Pair{btcUSD, ethUSD}))
+	checkQuote(t, quotes, btcUSD, 29990.5, 250.25)
+
+	_, err := Kraken{}.Feed([]Pair{btcUSD}).Handle([]byte(`[340,{"c":[]},"ticker","XBT/USD"]`))
+	if err == nil {
+		t.Error("no error for a malformed ticker")
+	}
+}
+
+func TestBitfinexFeed(t *testing.T) {
+	defer func(url string) { BitfinexStream = url }(BitfinexStream)
+	BitfinexStream = mockStream(t, func(conn *websocket.Conn, req *http.Request) {
+		// bitfinex takes a subscription per pair and assigns each a channel id
+		for i, want := range []string{"tBTCUSD", "tETHUSD"} {
+			msg := readJSON(t, conn)
+			if msg["event"] != "subscribe" || msg["channel"] != "ticker" || msg["symbol"] != want {
+				t.Errorf("got subscription %v, want %s", msg, want)
+			}
+			conn.WriteJSON(map[string]interface{}{"event": "subscribed", "channel": "ticker", "chanId": 10 + i, "symbol": want})
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`[11,"hb"]`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`[99,[1,1,1,1,1,1,5,5,1,1]]`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`[11,[2000,1,2001,1,10,0.005,2000.25,4321.5,2100,1900]]`))
+	})
+
+	quotes := streamQuotes(t, Bitfinex{}, Bitfinex{}.Feed([]Pair{btcUSD, ethUSD}))
+	checkQuote(t, quotes, ethUSD, 2000.25, 4321.5)
+	if len(quotes) != 1 {
+		t.Errorf("got quotes for %d pairs, want the unknown channel ignored", len(quotes))
+	}
+}
+
+func TestStreamReconnects(t *testing.T) {
+	defer func(url string, backoff time.Duration) { CoinbaseStream, minBackoff = url, backoff }(CoinbaseStream, minBackoff)
+	minBackoff = 10 * time.Millisecond
+
+	// every connection gets a single tick and is then dropped by the server
+	var lock sync.Mutex
+	subscriptions := 0
+	CoinbaseStream = mockStream(t, func(conn *websocket.Conn, req *http.Request) {
+		msg := readJSON(t, conn)
+		if msg["type"] != "subscribe" {
+			t.Errorf("got %v instead of a subscription", msg)
+			return
+		}
+		lock.Lock()
+		subscriptions++
+		price := subscriptions
+		lock.Unlock()
+		conn.WriteJSON(map[string]interface{}{"type": "ticker", "product_id": "BTC-USD", "price": strings.Repeat("1", price), "volume_24h": "1"})
+	})
+
+	store = NewStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		stream(ctx, Coinbase{}, []Pair{btcUSD})
+		close(stopped)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lock.Lock()
+		n := subscriptions
+		lock.Unlock()
+		if n >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only subscribed %d times before the deadline", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stream didn't stop after ctx was cancelled")
+	}
+	if quote, ok := store.Snapshot().Get("Coinbase", btcUSD); !ok || quote.Price < 11 {
+		t.Errorf("got quote %+v, want one from a later connection", quote)
+	}
+}
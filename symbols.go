@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+)
+
+// Pair is a canonical trading pair, eg BTC/USD
+type Pair struct {
+	Base  string `json:"asset"`
+	Quote string `json:"quote"`
+}
+
+// String returns the pair in BASE/QUOTE form
+func (p Pair) String() string {
+	return p.Base + "/" + p.Quote
+}
+
+// aliases maps alternate names used by some exchanges to the canonical asset name
+var aliases = map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+}
+
+// SymbolTable translates canonical pairs to and from the symbols used by an exchange
+type SymbolTable struct {
+	// Prefix is prepended to every pair symbol, eg "t" on Bitfinex
+	Prefix string
+	// Assets maps canonical asset names to the exchange's names where they differ
+	Assets map[string]string
+	// Aliases maps other names the exchange uses in its responses to canonical asset names
+	Aliases map[string]string
+	// Format joins the exchange's base and quote names into a pair symbol, without the prefix
+	Format func(base string, quote string) string
+	// Pairs holds symbols for pairs that can't be built using Format
+	Pairs map[Pair]string
+}
+
+// asset returns the exchange's name for a canonical asset
+func (t SymbolTable) asset(asset string) string {
+	if name, ok := t.Assets[asset]; ok {
+		return name
+	}
+	return asset
+}
+
+// canonical returns the canonical name of an asset named by the exchange
+func (t SymbolTable) canonical(name string) string {
+	if asset, ok := t.Aliases[name]; ok {
+		return asset
+	}
+	for asset, exchangeName := range t.Assets {
+		if exchangeName == name {
+			return asset
+		}
+	}
+	if asset, ok := aliases[name]; ok {
+		return asset
+	}
+	return name
+}
+
+// Symbol returns the exchange's symbol for a canonical pair
+func (t SymbolTable) Symbol(pair Pair) string {
+	if symbol, ok := t.Pairs[pair]; ok {
+		return symbol
+	}
+	return t.Prefix + t.Format(t.asset(pair.Base), t.asset(pair.Quote))
+}
+
+// Parse maps a symbol returned by the exchange back to one of the candidate pairs. Exchanges don't
+// always separate the base and quote assets, so we try each split of the symbol against the candidates
+func (t SymbolTable) Parse(symbol string, candidates []Pair) (Pair, bool) {
+	for _, pair := range candidates {
+		if t.Symbol(pair) == symbol {
+			return pair, true
+		}
+	}
+
+	symbol = strings.TrimPrefix(symbol, t.Prefix)
+	symbol = strings.NewReplacer("-", "", ":", "", "/", "", "_", "").Replace(symbol)
+	for i := 1; i < len(symbol); i++ {
+		pair := Pair{Base: t.canonical(symbol[:i]), Quote: t.canonical(symbol[i:])}
+		for _, candidate := range candidates {
+			if candidate == pair {
+				return pair, true
+			}
+		}
+	}
+	return Pair{}, false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	errors "github.com/pkg/errors"
+)
+
+// webhookTimeout is how long a webhook has to respond before the attempt is counted as failed
+var webhookTimeout = 10 * time.Second
+
+// WebhookConfig is a single webhook in the notify section of the config file
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+	// Secret signs each request so the receiver can check it came from us. Requests aren't signed if it isn't set
+	Secret string `yaml:"secret"`
+}
+
+// WebhookPayload is the JSON body posted to webhooks when an alert fires or resolves
+type WebhookPayload struct {
+	Rule      string    `json:"rule"`
+	State     string    `json:"state"`
+	Asset     string    `json:"asset"`
+	Quote     string    `json:"quote"`
+	Exchange  string    `json:"exchange,omitempty"`
+	Value     float64   `json:"value"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookNotifier posts alerts as JSON to a URL
+type WebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier posting to the webhook in c
+func NewWebhookNotifier(c WebhookConfig) *WebhookNotifier {
+	return &WebhookNotifier{url: c.URL, secret: c.Secret, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Name returns the webhook's URL
+func (n *WebhookNotifier) Name() string {
+	return "webhook " + n.url
+}
+
+// Notify posts an alert to the webhook, retrying failed requests and server errors
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(WebhookPayload{
+		Rule:      alert.Rule,
+		State:     alert.State,
+		Asset:     alert.Asset,
+		Quote:     alert.Quote,
+		Exchange:  alert.Exchange,
+		Value:     alert.Value,
+		Message:   alert.Message,
+		Timestamp: alert.Since,
+	})
+	if err != nil {
+		return err
+	}
+
+	return retry(ctx, n.Name(), func() error {
+		return n.post(ctx, body, time.Now())
+	})
+}
+
+// sign returns the hex HMAC-SHA256 of the timestamp and body. The timestamp is signed along
+// with the body so that receivers can reject requests that are replayed later
+func sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// post makes a single attempt at posting body to the webhook
+func (n *WebhookNotifier) post(ctx context.Context, body []byte, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return permanent(errors.Wrap(err, "could not build webhook request"))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		req.Header.Set("X-Demodash-Timestamp", timestamp)
+		req.Header.Set("X-Demodash-Signature", "sha256="+sign(n.secret, timestamp, body))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "webhook request failed")
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	err = errors.New("webhook responded with " + res.Status)
+	if res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return permanent(err)
+}
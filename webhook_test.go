@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookStandIn is a webhook receiver that answers each request with the next status in statuses,
+// then with 200 once they run out
+type webhookStandIn struct {
+	sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (s *webhookStandIn) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	s.Lock()
+	defer s.Unlock()
+	s.requests = append(s.requests, req)
+	s.bodies = append(s.bodies, body)
+	status := http.StatusOK
+	if len(s.statuses) != 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// testWebhook posts an alert to a stand-in answering with statuses, returning the stand-in and Notify's error
+func testWebhook(t *testing.T, secret string, statuses ...int) (*webhookStandIn, error) {
+	t.Helper()
+	defer func(backoff time.Duration) { notifyBackoff = backoff }(notifyBackoff)
+	notifyBackoff = time.Millisecond
+	testConfig(t, baseConfig+"notify:\n  retries: 3\n")
+
+	standIn := &webhookStandIn{statuses: statuses}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(WebhookConfig{URL: server.URL, Secret: secret})
+	alert := Alert{Rule: "btc-high", State: AlertFiring, Asset: "BTC", Quote: "USD", Value: 31000, Message: "BTC/USD index above 30000", Since: time.Unix(1700000000, 0).UTC()}
+	err := notifier.Notify(context.Background(), alert)
+	return standIn, err
+}
+
+func TestWebhookPayload(t *testing.T) {
+	standIn, err := testWebhook(t, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(standIn.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(standIn.requests))
+	}
+	req, body := standIn.requests[0], standIn.bodies[0]
+
+	var payload WebhookPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WebhookPayload{Rule: "btc-high", State: AlertFiring, Asset: "BTC", Quote: "USD", Value: 31000,
+		Message: "BTC/USD index above 30000", Timestamp: time.Unix(1700000000, 0).UTC()}
+	if payload != want {
+		t.Errorf("got payload %+v, want %+v", payload, want)
+	}
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got %s request with content type %q", req.Method, req.Header.Get("Content-Type"))
+	}
+
+	// receivers check the signature by computing the HMAC of the timestamp and body themselves
+	timestamp := req.Header.Get("X-Demodash-Timestamp")
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	if signature := req.Header.Get("X-Demodash-Signature"); signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("got signature %q for timestamp %q", signature, timestamp)
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	standIn, err := testWebhook(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature := standIn.requests[0].Header.Get("X-Demodash-Signature"); signature != "" {
+		t.Errorf("request without a secret was signed: %q", signature)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	for _, test := range []struct {
+		statuses []int
+		requests int
+		failed   bool
+	}{
+		{[]int{http.StatusBadGateway, http.StatusTooManyRequests}, 3, false},
+		{[]int{500, 500, 500, 500}, 4, true},
+		{[]int{http.StatusBadRequest}, 1, true},
+		{[]int{http.StatusServiceUnavailable, http.StatusNotFound}, 2, true},
+	} {
+		standIn, err := testWebhook(t, "s3cret", test.statuses...)
+		if (err != nil) != test.failed {
+			t.Errorf("statuses %v: got error %v", test.statuses, err)
+		}
+		if len(standIn.requests) != test.requests {
+			t.Errorf("statuses %v: got %d requests, want %d", test.statuses, len(standIn.requests), test.requests)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// wsBuffer is how many ticks are queued for each websocket client. Ticks are dropped for
+	// clients that fall further behind than this, so a slow client can't hold up the poller
+	wsBuffer = 256
+	// wsWriteTimeout is how long a write to a websocket client can take before we disconnect it
+	wsWriteTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WSRequest is a message sent by websocket clients to change their subscriptions. Asset and
+// exchange can be left empty or set to "*" to match every asset or exchange
+type WSRequest struct {
+	Action   string `json:"action"` // subscribe or unsubscribe
+	Asset    string `json:"asset"`
+	Exchange string `json:"exchange"`
+}
+
+// WSMessage is a message sent to websocket clients
+type WSMessage struct {
+	Type    string  `json:"type"` // tick, subscribed, unsubscribed or error
+	Message string  `json:"message,omitempty"`
+	Tick    *Update `json:"tick,omitempty"`
+}
+
+// subscription is an asset and exchange combination that a websocket client is subscribed to
+type subscription struct {
+	asset    string
+	exchange string
+}
+
+// matches checks whether an update is covered by the subscription
+func (s subscription) matches(update Update) bool {
+	return (s.asset == "*" || s.asset == update.Base) &&
+		(s.exchange == "*" || s.exchange == update.Exchange)
+}
+
+// wsClient is a single websocket connection and the subscriptions it has made. It's only
+// used by the goroutine writing to the connection, so it doesn't need a lock
+type wsClient struct {
+	conn          *websocket.Conn
+	subscriptions map[subscription]bool
+}
+
+// wanted checks whether the client is subscribed to an update
+func (c *wsClient) wanted(update Update) bool {
+	for sub := range c.subscriptions {
+		if sub.matches(update) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveWS lets downstream services subscribe to quote changes over a websocket on /ws
+func serveWS() {
+	http.HandleFunc("/ws", func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			log.Println("could not upgrade websocket connection", err)
+			return
+		}
+		defer conn.Close()
+
+		client := &wsClient{conn: conn, subscriptions: make(map[subscription]bool)}
+		updates := store.Subscribe(wsBuffer)
+		defer store.Unsubscribe(updates)
+
+		// the reader handles subscription requests, while this goroutine writes to the connection
+		requests := make(chan WSRequest)
+		done := make(chan struct{})
+		quit := make(chan struct{})
+		defer close(quit)
+		go func() {
+			defer close(done)
+			for {
+				var request WSRequest
+				err := conn.ReadJSON(&request)
+				if err != nil {
+					return
+				}
+				select {
+				case requests <- request:
+				case <-quit:
+					return
+				}
+			}
+		}()
+
+		for {
+			var message WSMessage
+			select {
+			case <-done:
+				return
+			case <-req.Context().Done():
+				// the server is shutting down
+				return
+			case request := <-requests:
+				message = client.handle(request)
+			case update := <-updates:
+				if !client.wanted(update) {
+					continue
+				}
+				update = checkUpdate(store.Snapshot(), update)
+				message = WSMessage{Type: "tick", Tick: &update}
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err := conn.WriteJSON(message)
+			if err != nil {
+				return
+			}
+
+			if message.Type == "subscribed" {
+				// send the current quotes so the client doesn't have to wait for them to change
+				err = client.sendSnapshot()
+				if err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// handle applies a subscription request from the client and returns the reply
+func (c *wsClient) handle(request WSRequest) WSMessage {
+	sub := subscription{asset: strings.ToUpper(request.Asset), exchange: request.Exchange}
+	if sub.asset == "" {
+		sub.asset = "*"
+	}
+	if sub.exchange == "" {
+		sub.exchange = "*"
+	}
+
+	if sub.asset != "*" && !contains(config.Assets, sub.asset) {
+		return WSMessage{Type: "error", Message: "unknown asset: " + request.Asset}
+	}
+	if sub.exchange != "*" {
+		exchange, ok := lookupExchange(sub.exchange)
+		if !ok || !active(exchange) {
+			return WSMessage{Type: "error", Message: "unknown exchange: " + request.Exchange}
+		}
+		// use the exchange's own name so subscriptions match however the client spells it
+		sub.exchange = exchange.Name()
+	}
+
+	switch request.Action {
+	case "subscribe":
+		c.subscriptions[sub] = true
+		return WSMessage{Type: "subscribed", Message: sub.asset + "@" + sub.exchange}
+	case "unsubscribe":
+		delete(c.subscriptions, sub)
+		return WSMessage{Type: "unsubscribed", Message: sub.asset + "@" + sub.exchange}
+	}
+	return WSMessage{Type: "error", Message: "unknown action: " + request.Action}
+}
+
+// sendSnapshot sends the client the latest quote for everything it's subscribed to
+func (c *wsClient) sendSnapshot() error {
+	snapshot := store.Snapshot()
+	for _, exchange := range exchanges {
+		for _, pair := range config.Pairs() {
+			update := Update{Exchange: exchange.Name(), Pair: pair, Ticker: lookupQuote(snapshot, exchange, pair)}
+			if !c.wanted(update) {
+				continue
+			}
+
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err := c.conn.WriteJSON(WSMessage{Type: "tick", Tick: &update})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWSClientSubscriptions(t *testing.T) {
+	testConfig(t, baseConfig)
+	client := &wsClient{subscriptions: make(map[subscription]bool)}
+	kraken := Update{Exchange: "Kraken", Pair: btcUSD}
+	binance := Update{Exchange: "Binance", Pair: btcUSD}
+
+	reply := client.handle(WSRequest{Action: "subscribe", Asset: "btc", Exchange: "Kraken"})
+	if reply.Type != "subscribed" || reply.Message != "BTC@Kraken" {
+		t.Fatalf("got reply %+v to subscribe", reply)
+	}
+	if !client.wanted(kraken) || client.wanted(binance) {
+		t.Error("subscription to BTC on Kraken doesn't match only Kraken's BTC updates")
+	}
+
+	// exchange names are case insensitive, so this undoes the subscription above
+	reply = client.handle(WSRequest{Action: "unsubscribe", Asset: "BTC", Exchange: "kraken"})
+	if reply.Type != "unsubscribed" {
+		t.Fatalf("got reply %+v to unsubscribe", reply)
+	}
+	if len(client.subscriptions) != 0 || client.wanted(kraken) {
+		t.Errorf("subscriptions left after unsubscribing: %v", client.subscriptions)
+	}
+
+	client.handle(WSRequest{Action: "subscribe"})
+	if !client.wanted(kraken) || !client.wanted(binance) {
+		t.Error("empty subscription doesn't match every update")
+	}
+
+	for _, request := range []WSRequest{
+		{Action: "subscribe", Asset: "DOGE"},
+		{Action: "subscribe", Exchange: "ftx"},
+		{Action: "list"},
+	} {
+		if reply := client.handle(request); reply.Type != "error" {
+			t.Errorf("got reply %+v to %+v, want an error", reply, request)
+		}
+	}
+}